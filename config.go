@@ -0,0 +1,300 @@
+package main
+
+import (
+	"./wal"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// configuration holds every setting of the server. Settings are read from
+// the configuration file, then from the environment and last from the
+// command line, every source overriding the previous ones.
+type configuration struct {
+	Address         string   `json:"address"`
+	Port            string   `json:"port"`
+	ReadTimeout     duration `json:"read_timeout"`
+	WriteTimeout    duration `json:"write_timeout"`
+	IdleTimeout     duration `json:"idle_timeout"`
+	ShutdownTimeout duration `json:"shutdown_timeout"`
+	MaxRequestSize  int64    `json:"max_request_size"`
+	DataDir         string   `json:"datadir"`
+	WAL             string   `json:"wal"`
+	LogLevel        string   `json:"log_level"`
+	TLSCert         string   `json:"tls_cert"`
+	TLSKey          string   `json:"tls_key"`
+	TLSClientCA     string   `json:"tls_client_ca"`
+	APIKeys         string   `json:"api_keys"`
+	DefaultResults  int      `json:"default_results"`
+	MaxResults      int      `json:"max_results"`
+	MaxDistance     int      `json:"max_distance"`
+}
+
+func defaultConfiguration() *configuration {
+	return &configuration{
+		Port:            "8080",
+		ReadTimeout:     duration(time.Minute),
+		WriteTimeout:    duration(time.Minute),
+		IdleTimeout:     duration(2 * time.Minute),
+		ShutdownTimeout: duration(30 * time.Second),
+		MaxRequestSize:  32 << 20,
+		LogLevel:        "info",
+		DefaultResults:  10,
+		MaxResults:      1000,
+	}
+}
+
+// duration is a time.Duration written as a string such as "30s", both in
+// the configuration file and on the command line
+type duration time.Duration
+
+func (d duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d *duration) Set(s string) error {
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("%q is not a duration such as 30s", s)
+	}
+	*d = duration(parsed)
+	return nil
+}
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("%s is not a duration such as \"30s\"", data)
+	}
+	return d.Set(s)
+}
+
+type stringValue string
+
+func (s stringValue) String() string { return string(s) }
+
+func (s *stringValue) Set(value string) error {
+	*s = stringValue(value)
+	return nil
+}
+
+type intValue int
+
+func (i intValue) String() string { return strconv.Itoa(int(i)) }
+
+func (i *intValue) Set(value string) error {
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("%q is not an integer", value)
+	}
+	*i = intValue(parsed)
+	return nil
+}
+
+type int64Value int64
+
+func (i int64Value) String() string { return strconv.FormatInt(int64(i), 10) }
+
+func (i *int64Value) Set(value string) error {
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%q is not an integer", value)
+	}
+	*i = int64Value(parsed)
+	return nil
+}
+
+// setting describes a field of the configuration. Its command line flag is
+// its name, its environment variable is its name in upper case, with
+// underscores instead of dashes, prefixed by FUZZYGUY_.
+type setting struct {
+	name  string
+	usage string
+	value func(conf *configuration) flag.Value
+}
+
+var settings = []setting{
+	{"address", "the address to bind to, every interface when empty",
+		func(conf *configuration) flag.Value { return (*stringValue)(&conf.Address) }},
+	{"port", "the port to listen on",
+		func(conf *configuration) flag.Value { return (*stringValue)(&conf.Port) }},
+	{"read-timeout", "the maximum duration for reading a request",
+		func(conf *configuration) flag.Value { return &conf.ReadTimeout }},
+	{"write-timeout", "the maximum duration for writing a response",
+		func(conf *configuration) flag.Value { return &conf.WriteTimeout }},
+	{"idle-timeout", "how long idle keep-alive connections are kept open",
+		func(conf *configuration) flag.Value { return &conf.IdleTimeout }},
+	{"shutdown-timeout", "how long in-flight requests may take to finish when stopping",
+		func(conf *configuration) flag.Value { return &conf.ShutdownTimeout }},
+	{"max-request-size", "the maximum size of a request body, in bytes",
+		func(conf *configuration) flag.Value { return (*int64Value)(&conf.MaxRequestSize) }},
+	{"datadir", "the directory holding the snapshots, stores are not persisted when empty",
+		func(conf *configuration) flag.Value { return (*stringValue)(&conf.DataDir) }},
+	{"wal", "when write-ahead logs are synced: always, never or an interval, disabled when empty",
+		func(conf *configuration) flag.Value { return (*stringValue)(&conf.WAL) }},
+	{"log-level", "the minimum level of logged messages: debug, info, warn or error",
+		func(conf *configuration) flag.Value { return (*stringValue)(&conf.LogLevel) }},
+	{"tls-cert", "the TLS certificate file, the server uses plain HTTP when empty",
+		func(conf *configuration) flag.Value { return (*stringValue)(&conf.TLSCert) }},
+	{"tls-key", "the TLS private key file",
+		func(conf *configuration) flag.Value { return (*stringValue)(&conf.TLSKey) }},
+	{"tls-client-ca", "the authorities of the client certificates, clients need none when empty",
+		func(conf *configuration) flag.Value { return (*stringValue)(&conf.TLSClientCA) }},
+	{"api-keys", "the file of API keys clients must authenticate with, requests are not authenticated when empty",
+		func(conf *configuration) flag.Value { return (*stringValue)(&conf.APIKeys) }},
+	{"default-results", "the number of results of a query which does not ask for one",
+		func(conf *configuration) flag.Value { return (*intValue)(&conf.DefaultResults) }},
+	{"max-results", "the maximum number of results a query may ask for",
+		func(conf *configuration) flag.Value { return (*intValue)(&conf.MaxResults) }},
+	{"max-distance", "the maximum distance a query may ask for, unlimited when 0",
+		func(conf *configuration) flag.Value { return (*intValue)(&conf.MaxDistance) }},
+}
+
+func environmentName(name string) string {
+	return "FUZZYGUY_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// loadConfiguration reads the configuration file, the environment and the
+// command line arguments, and then validates the resulting configuration.
+// The file is conf.json unless another one is given through the -config flag
+// or the FUZZYGUY_CONFIG variable, and it may only be missing if it was not
+// given explicitly.
+func loadConfiguration(arguments []string, getenv func(string) string) (*configuration, error) {
+	flags := flag.NewFlagSet("fuzzyguy", flag.ContinueOnError)
+	path := flags.String("config", "", "the configuration file (default conf.json)")
+	parsed := defaultConfiguration()
+	for _, s := range settings {
+		flags.Var(s.value(parsed), s.name, s.usage+" (env "+environmentName(s.name)+")")
+	}
+	if err := flags.Parse(arguments); err != nil {
+		return nil, err
+	}
+
+	conf := defaultConfiguration()
+	if len(*path) == 0 {
+		*path = getenv("FUZZYGUY_CONFIG")
+	}
+	explicit := len(*path) != 0
+	if !explicit {
+		*path = "conf.json"
+	}
+	data, err := os.ReadFile(*path)
+	if err != nil && (explicit || !os.IsNotExist(err)) {
+		return nil, fmt.Errorf("could not read the configuration file: %v", err)
+	}
+	if err == nil {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err = decoder.Decode(conf); err != nil {
+			return nil, fmt.Errorf("invalid configuration file %s: %v", *path, err)
+		}
+	}
+
+	for _, s := range settings {
+		if value := getenv(environmentName(s.name)); len(value) != 0 {
+			if err = s.value(conf).Set(value); err != nil {
+				return nil, fmt.Errorf("invalid %s: %v", environmentName(s.name), err)
+			}
+		}
+	}
+	flags.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.name == f.Name {
+				s.value(conf).Set(f.Value.String())
+			}
+		}
+	})
+
+	if err = conf.validate(); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// validate reports every setting which is not valid, one per line
+func (conf *configuration) validate() error {
+	var problems []error
+	invalid := func(name, format string, arguments ...interface{}) {
+		problems = append(problems, fmt.Errorf("invalid %s: "+format, append([]interface{}{name}, arguments...)...))
+	}
+
+	if port, err := strconv.Atoi(conf.Port); err != nil || port < 1 || port > 65535 {
+		invalid("port", "%q is not a port number between 1 and 65535", conf.Port)
+	}
+	for _, timeout := range []struct {
+		name  string
+		value duration
+	}{
+		{"read_timeout", conf.ReadTimeout},
+		{"write_timeout", conf.WriteTimeout},
+		{"idle_timeout", conf.IdleTimeout},
+		{"shutdown_timeout", conf.ShutdownTimeout},
+	} {
+		if timeout.value < 0 {
+			invalid(timeout.name, "%v is negative", timeout.value)
+		}
+	}
+	if conf.MaxRequestSize <= 0 {
+		invalid("max_request_size", "%d is not a positive number of bytes", conf.MaxRequestSize)
+	}
+	if len(conf.WAL) != 0 {
+		if _, err := wal.ParseSyncPolicy(conf.WAL); err != nil {
+			invalid("wal", "%v", err)
+		} else if len(conf.DataDir) == 0 {
+			invalid("wal", "write-ahead logs need a datadir")
+		}
+	}
+	if _, err := conf.logLevel(); err != nil {
+		invalid("log_level", "%v", err)
+	}
+	if (len(conf.TLSCert) == 0) != (len(conf.TLSKey) == 0) {
+		invalid("tls_cert", "tls_cert and tls_key must be given together")
+	}
+	if len(conf.TLSClientCA) != 0 && len(conf.TLSCert) == 0 {
+		invalid("tls_client_ca", "client certificates need tls_cert and tls_key")
+	}
+	for _, file := range []struct{ name, path string }{
+		{"tls_cert", conf.TLSCert},
+		{"tls_key", conf.TLSKey},
+		{"tls_client_ca", conf.TLSClientCA},
+		{"api_keys", conf.APIKeys},
+	} {
+		if len(file.path) == 0 {
+			continue
+		}
+		if _, err := os.Stat(file.path); err != nil {
+			invalid(file.name, "%v", err)
+		}
+	}
+	if conf.DefaultResults < 1 {
+		invalid("default_results", "%d is not a positive number of results", conf.DefaultResults)
+	}
+	if conf.MaxResults < conf.DefaultResults {
+		invalid("max_results", "%d is smaller than default_results", conf.MaxResults)
+	}
+	if conf.MaxDistance < 0 {
+		invalid("max_distance", "%d is negative", conf.MaxDistance)
+	}
+	return errors.Join(problems...)
+}
+
+func (conf *configuration) logLevel() (slog.Level, error) {
+	switch conf.LogLevel {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("%q is not one of debug, info, warn or error", conf.LogLevel)
+}
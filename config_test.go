@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfiguration(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "conf.json")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func environment(variables map[string]string) func(string) string {
+	return func(name string) string {
+		return variables[name]
+	}
+}
+
+func TestConfigurationPrecedence(t *testing.T) {
+	path := writeConfiguration(t, `{"port": "8081", "datadir": "file", "read_timeout": "5s", "max_results": 50}`)
+	env := environment(map[string]string{
+		"FUZZYGUY_CONFIG":  path,
+		"FUZZYGUY_DATADIR": "env",
+		"FUZZYGUY_PORT":    "8082",
+	})
+	conf, err := loadConfiguration([]string{"-port", "8083", "-default-results", "20"}, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Port != "8083" || conf.DataDir != "env" || conf.MaxResults != 50 || conf.DefaultResults != 20 {
+		t.Log(*conf)
+		t.Error("Flags should override the environment, which should override the file")
+	}
+	if time.Duration(conf.ReadTimeout) != 5*time.Second || time.Duration(conf.WriteTimeout) != time.Minute {
+		t.Log(*conf)
+		t.Error("Failed to read the durations")
+	}
+}
+
+func TestConfigurationFile(t *testing.T) {
+	if _, err := loadConfiguration([]string{"-config", "missing.json"}, environment(nil)); err == nil {
+		t.Error("A missing configuration file which was asked for should be an error")
+	}
+
+	path := writeConfiguration(t, `{"prot": "8080"}`)
+	if _, err := loadConfiguration([]string{"-config", path}, environment(nil)); err == nil || !strings.Contains(err.Error(), "prot") {
+		t.Error("Unknown settings should be reported", err)
+	}
+
+	path = writeConfiguration(t, `{"idle_timeout": 30}`)
+	if _, err := loadConfiguration([]string{"-config", path}, environment(nil)); err == nil {
+		t.Error("Durations should be strings")
+	}
+}
+
+func TestConfigurationValidation(t *testing.T) {
+	path := writeConfiguration(t, `{}`)
+	arguments := []string{
+		"-config", path,
+		"-port", "http",
+		"-wal", "100ms",
+		"-log-level", "verbose",
+		"-tls-cert", "cert.pem",
+		"-tls-client-ca", "ca.pem",
+		"-max-results", "5",
+		"-max-request-size", "0",
+	}
+	_, err := loadConfiguration(arguments, environment(nil))
+	if err == nil {
+		t.Fatal("Invalid configuration was accepted")
+	}
+	for _, setting := range []string{"port", "wal", "log_level", "tls_cert", "tls_client_ca", "max_results", "max_request_size"} {
+		if !strings.Contains(err.Error(), "invalid "+setting+":") {
+			t.Error("Invalid", setting, "was not reported in:", err)
+		}
+	}
+
+	if _, err = loadConfiguration([]string{"-config", path, "-read-timeout", "soon"}, environment(nil)); err == nil {
+		t.Error("Invalid duration flag was accepted")
+	}
+	if _, err = loadConfiguration([]string{"-config", path}, environment(map[string]string{"FUZZYGUY_MAX_DISTANCE": "two"})); err == nil {
+		t.Error("Invalid environment variable was accepted")
+	}
+	if _, err = loadConfiguration([]string{"-config", path}, environment(nil)); err != nil {
+		t.Error("Default configuration should be valid:", err)
+	}
+}
@@ -0,0 +1,90 @@
+package fuzzy
+
+import (
+	"../levenshtein"
+	"container/heap"
+	"sort"
+	"sync"
+	"unicode/utf8"
+)
+
+// PrefixQuery the service for keys which start with something within a
+// Levenshtein distance threshold of a prefix, which makes for a fuzzy
+// autocomplete: "fuzz" or "fyzz" both find "fuzzyguy". Take only the first
+// x results, ranked like the ones of Query. If the service has a cost model,
+// the threshold bounds the total cost of the edits, as in QueryMetric.
+//
+// Since only the beginning of a key takes part in the comparison, the
+// histograms of whole keys can not filter candidates and every key long
+// enough is compared to the prefix. The phonetic encoder of the service, if
+// any, takes no part: a prefix does not sound like the keys it starts, so
+// every match is a SpellingMatch.
+//
+// Arugments:
+// query (string): the prefix typed so far
+// threshold (int): how far can the beginning of a candidate be from the
+// query in the Levenshtein metric space, or in total cost of the edits
+// maxResults (int): the maximum number of results which will be returned
+//
+// Returns: ([]Match) the keys found along with their values and the
+// distances between their beginnings and the query
+func (service Service) PrefixQuery(query string, threshold, maxResults int) []Match {
+	query = service.normalize(query)
+	distance := func(matcher *levenshtein.Matcher, key string) (float64, bool) {
+		distance, within := matcher.PrefixDistanceThreshold(key, threshold)
+		return float64(distance), within
+	}
+	// With a cost model the threshold allows as many edits as fit in it, or
+	// any number of them if edits may cost nothing
+	edits := threshold
+	if costs := service.options.Costs; costs != nil {
+		distance = func(matcher *levenshtein.Matcher, key string) (float64, bool) {
+			return matcher.WeightedPrefixDistanceThreshold(key, float64(threshold), costs)
+		}
+		edits = levenshtein.MaxEdits(float64(threshold), costs)
+	}
+	h := new(keyScoreHeap)
+	heap.Init(h)
+	queryLen := utf8.RuneCountInString(query)
+	heapMutex := &sync.Mutex{}
+	var wait sync.WaitGroup
+
+	service.rwmutex.RLock()
+	for length, bucket := range service.dictionary {
+		// Keys shorter than this would need too many insertions
+		if edits >= 0 && length < queryLen-edits {
+			continue
+		}
+		wait.Add(1)
+		go func(bucket map[uint32][]storage, mutex *sync.Mutex) {
+			matcher := getMatcher(query)
+			for _, list := range bucket {
+				for _, pair := range list {
+					distance, within := distance(matcher, pair.key)
+					if within {
+						mutex.Lock()
+						heap.Push(h, keyScore{prefix(pair.key, query), distance, pair.original, pair.values, false})
+						if h.Len() > maxResults {
+							heap.Pop(h)
+						}
+						mutex.Unlock()
+					}
+				}
+			}
+			matchers.Put(matcher)
+			wait.Done()
+		}(bucket, heapMutex)
+	}
+	wait.Wait()
+	service.rwmutex.RUnlock()
+
+	sort.Sort(h)
+	results := make([]Match, h.Len())
+	for i := 0; i < len(results); i++ {
+		results[i] = service.match(h.Pop().(keyScore))
+		if service.options.Phonetic != nil {
+			results[i].Kind = SpellingMatch
+		}
+	}
+	return results
+}
@@ -0,0 +1,83 @@
+package fuzzy
+
+import (
+	"../levenshtein"
+	"testing"
+)
+
+func TestPrefixQuery(t *testing.T) {
+	service := NewService()
+	service.Set("fuzzyguy", "project")
+	service.Set("fuzzy", "adjective")
+	service.Set("fizzy", "drink")
+	service.Set("buzz", "noise")
+	service.Set("éléphant", "animal")
+
+	result := service.PrefixQuery("fuzz", 0, 5)
+	if len(result) != 2 || result[0].Key != "fuzzy" || result[1].Key != "fuzzyguy" {
+		t.Log(result)
+		t.Error("Failed to complete an exact prefix")
+	}
+
+	result = service.PrefixQuery("fyzz", 1, 5)
+	if len(result) != 3 || result[0].Key != "fizzy" || result[0].Distance != 1 {
+		t.Log(result)
+		t.Error("Failed to complete a misspelled prefix")
+	}
+
+	result = service.PrefixQuery("fuzz", 1, 1)
+	if len(result) != 1 || result[0].Key != "fuzzy" || result[0].Value != "adjective" {
+		t.Log(result)
+		t.Error("Failed to limit the number of completions")
+	}
+
+	result = service.PrefixQuery("elep", 2, 5)
+	if len(result) != 1 || result[0].Key != "éléphant" || result[0].Distance != 2 {
+		t.Log(result)
+		t.Error("Failed to complete a multi-byte key")
+	}
+
+	if result = service.PrefixQuery("zzz", 1, 5); len(result) != 0 {
+		t.Log(result)
+		t.Error("Prefix should not match the middle of keys")
+	}
+}
+
+func TestPrefixQueryCosts(t *testing.T) {
+	service := NewServiceWithOptions(Options{Costs: levenshtein.NewKeyboardCosts(levenshtein.QWERTY, 0.5)})
+	service.Set("fuzzyguy", "project")
+	service.Set("fizzy", "drink")
+	service.Set("fyz", "short")
+
+	/* Y is next to U but not to I on the keyboard */
+	result := service.PrefixQuery("fyzz", 1, 5)
+	distances := map[string]float64{}
+	for _, match := range result {
+		distances[match.Key] = match.Distance
+	}
+	if len(result) != 3 || distances["fuzzyguy"] != 0.5 || distances["fizzy"] != 1 || distances["fyz"] != 1 {
+		t.Log(result)
+		t.Error("Prefix query should weight the edits with the cost model")
+	}
+
+	/* Edits costing nothing do not bound the length of the keys */
+	service = NewServiceWithOptions(Options{Costs: levenshtein.NewKeyboardCosts(levenshtein.QWERTY, 0)})
+	service.Set("f", "letter")
+	if result := service.PrefixQuery("fyzz", 0, 5); len(result) != 0 {
+		t.Log(result)
+		t.Error("Deletions should still cost something")
+	}
+	service.Set("fuzzyguy", "project")
+	if result := service.PrefixQuery("fyzz", 0, 5); len(result) != 1 || result[0].Distance != 0 {
+		t.Log(result)
+		t.Error("Prefix query should find the keys at no cost")
+	}
+}
+
+func BenchmarkPrefixQuery(b *testing.B) {
+	_, _, service := LoadTestSet(testFile)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		service.PrefixQuery("informa", 1, 5)
+	}
+}
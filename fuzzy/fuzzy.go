@@ -4,27 +4,39 @@
 // Service -> data structure to encapsulate all information
 //
 // Exported functions:
-// NewService -> constructor function.
-// Get, Set, Len, Query -> methods for the Service type.
+// NewService, NewServiceWithOptions -> constructor functions.
+// Get, GetAll, Set, Delete, DeleteValue, Len, Size, Stats, Range, Scan, Query,
+// QueryResults, QueryMetric, QuerySimilarity, QueryTokens -> methods for the
+// Service type.
 package fuzzy
 
 import (
 	"../levenshtein"
+	"../phonetic"
 	"container/heap"
 	"sort"
 	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+	"unsafe"
 )
 
 type service interface {
 	Set(key, value string)
 	Get(key string) (string, bool)
 	Query(key string, distance, maxResults int) []string
+	QueryResults(key string, distance, maxResults int) []Match
+	QueryMetric(key string, metric Metric, distance, maxResults int) []Match
 	Len() int
 }
 
+// storage holds an indexed key, normalized if the service has a normalizer,
+// along with the key as it was given, which is the one shown in results, and
+// the values it indexes. Only multimap services index more than one value.
 type storage struct {
 	key      string
-	value    string
+	original string
+	values   []string
 	extended uint64
 }
 
@@ -34,13 +46,49 @@ type storage struct {
 // Attributes:
 // dictionary (map[int]map[uint32][]storage): Maps each storage type
 // (which encapsulates necessary data) to its corresponding 32bit histogram
-// and the length of the key indexed
+// and the length of the key indexed, measured in runes
 //
 // rwmutex (*sync.RWMutex): Read-write mutex used to synchronize operations on
 // the dictionary without having data races
+//
+// keys (*atomic.Int64): the number of keys in the dictionary, updated along
+// with it so that Len does not have to walk the dictionary
+//
+// options (Options): the optional settings given at construction
+//
+// sounds (map[string][]string): maps every phonetic code to the indexed keys
+// sounding like it, in services with a phonetic encoder
 type Service struct {
 	dictionary map[int]map[uint32][]storage
 	rwmutex    *sync.RWMutex
+	keys       *atomic.Int64
+	options    Options
+	sounds     map[string][]string
+}
+
+// Options holds the optional settings of a Service. The zero value gives
+// the Service created by NewService.
+//
+// Attributes:
+// Costs (levenshtein.CostModel): weights every edit made by the distances
+// used in queries. When nil, every edit costs exactly 1.
+//
+// Normalizer (Normalizer): applied to every key given to the service, both
+// when indexing and when looking up. Keys which normalize to the same string
+// are the same key, which is shown as it was last set. When nil, keys are
+// used as they are.
+//
+// Multimap (bool): makes Set add values to a key instead of replacing its
+// value, so that a key may index several values.
+//
+// Phonetic (phonetic.Encoder): indexes the phonetic codes of the keys along
+// with them, so that queries also find the keys sounding like the query
+// however they are spelled. The codes are computed from the normalized keys.
+type Options struct {
+	Costs      levenshtein.CostModel
+	Normalizer Normalizer
+	Multimap   bool
+	Phonetic   phonetic.Encoder
 }
 
 // NewService is a constructor function for a Service object.
@@ -50,27 +98,66 @@ type Service struct {
 // Returns: (*Service) a pointer to an object which can then be used
 // to manipulate data through the Set/Get/Query operations.
 func NewService() *Service {
+	return NewServiceWithOptions(Options{})
+}
+
+// NewServiceWithOptions is a constructor function for a Service object
+// with optional settings.
+//
+// Arugments:
+// options (Options): the settings of the service
+//
+// Returns: (*Service) a pointer to an object which can then be used
+// to manipulate data through the Set/Get/Query operations.
+func NewServiceWithOptions(options Options) *Service {
 	dict := make(map[int]map[uint32][]storage)
 	mutex := &sync.RWMutex{}
-	return &Service{dict, mutex}
+	var sounds map[string][]string
+	if options.Phonetic != nil {
+		sounds = make(map[string][]string)
+	}
+	return &Service{dict, mutex, new(atomic.Int64), options, sounds}
+}
+
+// normalize applies the normalizer of the service to a key
+func (service Service) normalize(key string) string {
+	if service.options.Normalizer == nil {
+		return key
+	}
+	return service.options.Normalizer(key)
+}
+
+// Multimap tells whether keys of the service may index several values
+func (service Service) Multimap() bool {
+	return service.options.Multimap
 }
 
-// Set a value to be indexed by a specific key in the system
+// Set a value to be indexed by a specific key in the system. In a multimap
+// service the value is added to the ones the key already indexes, unless it
+// is one of them.
 //
 // Arguments:
 // key (string): the key to index the specific value
 // value (string): the value to be indexed by the specified key
 func (service Service) Set(key, value string) {
+	original, key := key, service.normalize(key)
 	histogram := levenshtein.ComputeHistogram(key)
-	storeValue := storage{key, value, levenshtein.ComputeExtendedHistogram(key)}
+	storeValue := storage{key, original, []string{value}, levenshtein.ComputeExtendedHistogram(key)}
+	keyLen := utf8.RuneCountInString(key)
+	codes := service.encode(key)
 	service.rwmutex.Lock()
-	bucket, present := service.dictionary[len(key)]
+	bucket, present := service.dictionary[keyLen]
 	if present {
 		list, histogramPresent := bucket[histogram]
 		if histogramPresent {
 			for i, pair := range list {
 				if pair.key == key {
-					list[i].value = value
+					if !service.options.Multimap {
+						list[i].values = storeValue.values
+					} else if indexOf(pair.values, value) < 0 {
+						list[i].values = append(pair.values, value)
+					}
+					list[i].original = original
 					service.rwmutex.Unlock()
 					return
 				}
@@ -81,8 +168,10 @@ func (service Service) Set(key, value string) {
 		}
 	} else {
 		bucket = map[uint32][]storage{histogram: {storeValue}}
-		service.dictionary[len(key)] = bucket
+		service.dictionary[keyLen] = bucket
 	}
+	service.addSounds(key, codes)
+	service.keys.Add(1)
 	service.rwmutex.Unlock()
 }
 
@@ -94,24 +183,17 @@ func (service Service) Set(key, value string) {
 //
 // Returns: (bool) wether the deletion was susccesful or not
 func (service Service) Delete(key string) bool {
+	key = service.normalize(key)
 	histogram := levenshtein.ComputeHistogram(key)
+	keyLen := utf8.RuneCountInString(key)
 	service.rwmutex.Lock()
-	bucket, present := service.dictionary[len(key)]
+	bucket, present := service.dictionary[keyLen]
 	if present {
 		list, histogramPresent := bucket[histogram]
 		if histogramPresent {
 			for index, pair := range list {
 				if pair.key == key {
-					list[index], list = list[len(list)-1], list[:len(list)-1]
-					if len(list) == 0 {
-						delete(bucket, histogram)
-						if len(bucket) == 0 {
-							delete(service.dictionary, len(key))
-						}
-						service.rwmutex.Unlock()
-						return true
-					}
-					bucket[histogram] = list
+					service.remove(keyLen, histogram, index)
 					service.rwmutex.Unlock()
 					return true
 				}
@@ -122,7 +204,75 @@ func (service Service) Delete(key string) bool {
 	return false
 }
 
-// Get the value associated with a specific key
+// DeleteValue removes a single value from the ones indexed by a key. The key
+// is deleted along with its last value.
+//
+// Arguments:
+// key (string): the key indexing the value
+// value (string): the value to be deleted
+//
+// Returns: (bool) wether the key indexed the value or not
+func (service Service) DeleteValue(key, value string) bool {
+	key = service.normalize(key)
+	histogram := levenshtein.ComputeHistogram(key)
+	keyLen := utf8.RuneCountInString(key)
+	service.rwmutex.Lock()
+	list := service.dictionary[keyLen][histogram]
+	for i, pair := range list {
+		if pair.key != key {
+			continue
+		}
+		index := indexOf(pair.values, value)
+		if index < 0 {
+			break
+		}
+		if len(pair.values) == 1 {
+			service.remove(keyLen, histogram, i)
+			service.rwmutex.Unlock()
+			return true
+		}
+		// The values are copied rather than shifted in place, since the
+		// queries may still be reading the old slice
+		values := make([]string, 0, len(pair.values)-1)
+		values = append(values, pair.values[:index]...)
+		list[i].values = append(values, pair.values[index+1:]...)
+		service.rwmutex.Unlock()
+		return true
+	}
+	service.rwmutex.Unlock()
+	return false
+}
+
+// remove deletes the entry at an index of a list, along with the list and
+// the bucket if they become empty. The caller must hold the write lock.
+func (service Service) remove(keyLen int, histogram uint32, index int) {
+	bucket := service.dictionary[keyLen]
+	list := bucket[histogram]
+	service.removeSounds(list[index].key)
+	list[index], list = list[len(list)-1], list[:len(list)-1]
+	service.keys.Add(-1)
+	if len(list) == 0 {
+		delete(bucket, histogram)
+		if len(bucket) == 0 {
+			delete(service.dictionary, keyLen)
+		}
+		return
+	}
+	bucket[histogram] = list
+}
+
+// indexOf returns the position of a value in a list, or -1 if it is missing
+func indexOf(values []string, value string) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
+
+// Get the value associated with a specific key. In a multimap service this is
+// the first value which was added to the key.
 //
 // Arguments:
 // key (string): the key whose value which we want to return
@@ -130,42 +280,160 @@ func (service Service) Delete(key string) bool {
 // Returns: (string, bool) tuple which represents (value, present). If present
 // is false then the value we return is the empty string ""
 func (service Service) Get(key string) (string, bool) {
+	values, present := service.GetAll(key)
+	if !present {
+		return "", false
+	}
+	return values[0], true
+}
+
+// GetAll returns every value associated with a specific key, in the order
+// they were added
+//
+// Arguments:
+// key (string): the key whose values we want to return
+//
+// Returns: ([]string, bool) tuple which represents (values, present). If
+// present is false then the values are nil
+func (service Service) GetAll(key string) ([]string, bool) {
+	key = service.normalize(key)
+	service.rwmutex.RLock()
+	pair, present := service.find(key)
+	service.rwmutex.RUnlock()
+	if !present {
+		return nil, false
+	}
+	return append([]string(nil), pair.values...), true
+}
+
+// find returns the entry of a normalized key. The caller must hold the lock.
+func (service Service) find(key string) (storage, bool) {
 	histogram := levenshtein.ComputeHistogram(key)
+	for _, pair := range service.dictionary[utf8.RuneCountInString(key)][histogram] {
+		if pair.key == key {
+			return pair, true
+		}
+	}
+	return storage{}, false
+}
+
+// Len returns the number of keys indexed by the system
+//
+// Returns: (int) the total number of keys indexed by the system
+func (service Service) Len() int {
+	return int(service.keys.Load())
+}
+
+// Stats describes how the keys are spread over the index of a Service.
+//
+// Attributes:
+// Keys (int): the number of keys
+// LengthBuckets (int): the number of distinct key lengths
+// Buckets (int): the number of distinct pairs of key length and histogram,
+// each of them holding a chain of keys compared one by one by queries
+// LongestChain (int): the number of keys in the largest of these buckets
+// Memory (int): an estimate of the memory taken by the index, in bytes
+type Stats struct {
+	Keys          int `json:"keys"`
+	LengthBuckets int `json:"length_buckets"`
+	Buckets       int `json:"buckets"`
+	LongestChain  int `json:"longest_chain"`
+	Memory        int `json:"memory"`
+}
+
+// Stats walks the index of the system to describe how skewed it is
+//
+// Returns: (Stats) the description of the index
+func (service Service) Stats() Stats {
+	var stats Stats
 	service.rwmutex.RLock()
-	bucket, present := service.dictionary[len(key)]
-	if present {
-		list, histogramPresent := bucket[histogram]
-		if histogramPresent {
+	stats.LengthBuckets = len(service.dictionary)
+	for _, bucket := range service.dictionary {
+		stats.Buckets += len(bucket)
+		for _, list := range bucket {
+			stats.Keys += len(list)
+			if len(list) > stats.LongestChain {
+				stats.LongestChain = len(list)
+			}
+			// Every histogram takes a map entry holding the histogram and
+			// the slice of entries, including its unused capacity
+			stats.Memory += 4 + int(unsafe.Sizeof(list)) + cap(list)*int(unsafe.Sizeof(storage{}))
 			for _, pair := range list {
-				if pair.key == key {
-					service.rwmutex.RUnlock()
-					return pair.value, true
-				}
+				stats.Memory += pair.size()
 			}
 		}
 	}
+	stats.Memory += service.soundsSize()
 	service.rwmutex.RUnlock()
-	return "", false
+	return stats
 }
 
-// Len returns the number of keys indexed by the system
+// size returns the number of bytes taken by the strings of an entry
+func (pair storage) size() int {
+	size := len(pair.key)
+	if pair.original != pair.key {
+		size += len(pair.original)
+	}
+	for _, value := range pair.values {
+		size += int(unsafe.Sizeof(value)) + len(value)
+	}
+	return size
+}
+
+// Size estimates the number of bytes taken by the keys and values indexed
+// by the system, including the bookkeeping kept for every key
 //
-// Returns: (int) the total number of keys indexed by the system
-func (service Service) Len() int {
-	result := 0
+// Returns: (int) the estimated size in bytes
+func (service Service) Size() int {
+	size := 0
 	service.rwmutex.RLock()
-	for _, dict := range service.dictionary {
-		result += len(dict)
+	for _, bucket := range service.dictionary {
+		for _, list := range bucket {
+			for _, pair := range list {
+				size += int(unsafe.Sizeof(pair)) + pair.size()
+			}
+		}
 	}
+	size += service.soundsSize()
 	service.rwmutex.RUnlock()
-	return result
+	return size
+}
+
+// Match is a key found by a fuzzy query, as it was given to Set, along with
+// the value it indexes, its distance to the query and the length in runes of
+// the prefix it has in common with the query. The distance is only
+// fractional for services weighting edits with a cost model and for
+// similarity queries, where it is 1 minus the similarity. In multimap
+// services Values holds every value of the key and Value the first one.
+// Services with a phonetic encoder tell whether the key was found by its
+// spelling, its sound or both in Kind.
+type Match struct {
+	Key      string   `json:"key"`
+	Value    string   `json:"value"`
+	Values   []string `json:"values,omitempty"`
+	Distance float64  `json:"distance"`
+	Prefix   int      `json:"prefix"`
+	Kind     string   `json:"kind,omitempty"`
 }
 
 // TODO: Move the keyScore, keyScoreHeap implementation to a different file
 type keyScore struct {
 	prefix int
-	score  int
+	score  float64
 	key    string
+	values []string
+	// Results of similarity queries are ranked by their score alone, which
+	// already rewards the prefix they have in common with the query
+	similarity bool
+}
+
+// match turns a result kept in the heap into a Match
+func (service Service) match(score keyScore) Match {
+	result := Match{Key: score.key, Value: score.values[0], Distance: score.score, Prefix: score.prefix}
+	if service.options.Multimap {
+		result.Values = append([]string(nil), score.values...)
+	}
+	return result
 }
 
 type keyScoreHeap []keyScore
@@ -181,14 +449,17 @@ func min(x, y int) int {
 	return y
 }
 
+// prefix returns the number of runes in the common prefix of two strings
 func prefix(source, target string) int {
 	prefix := 0
-	for i := 0; i < min(len(source), len(target)); i++ {
-		if source[i] == target[i] {
-			prefix++
-		} else {
+	for len(source) > 0 && len(target) > 0 {
+		sourceRune, sourceSize := utf8.DecodeRuneInString(source)
+		targetRune, targetSize := utf8.DecodeRuneInString(target)
+		if sourceRune != targetRune {
 			break
 		}
+		prefix++
+		source, target = source[sourceSize:], target[targetSize:]
 	}
 	return prefix
 }
@@ -196,7 +467,7 @@ func prefix(source, target string) int {
 // We implement the heap methods here: Less, Swap, Push, Pop
 
 func (h keyScoreHeap) Less(i, j int) bool {
-	if h[i].prefix != h[j].prefix {
+	if h[i].prefix != h[j].prefix && !h[i].similarity {
 		return h[i].prefix < h[j].prefix
 	}
 	if h[i].score != h[j].score {
@@ -228,6 +499,18 @@ func abs(x int) int {
 	return x
 }
 
+// matchers are reused from one query to the next along with their buffers,
+// so that comparing the query to the keys does not allocate
+var matchers = sync.Pool{New: func() interface{} { return new(levenshtein.Matcher) }}
+
+// getMatcher returns a matcher for a query, which should be put back into
+// matchers once the query is done with it
+func getMatcher(query string) *levenshtein.Matcher {
+	matcher := matchers.Get().(*levenshtein.Matcher)
+	matcher.Reset(query)
+	return matcher
+}
+
 // Query the service for keys which can have a Levenshtein distance smaller
 // than a threshold for a spefici key. Take only the first x result
 //
@@ -236,32 +519,96 @@ func abs(x int) int {
 // threshold (int): how far can a candidate be in the Levenshtein metric space
 // maxResults (int): the maximum number of results which will be returned
 func (service Service) Query(query string, threshold, maxResults int) []string {
+	matches := service.QueryResults(query, threshold, maxResults)
+	results := make([]string, len(matches))
+	for i, match := range matches {
+		results[i] = match.Key
+	}
+	return results
+}
+
+// QueryResults works just like Query, but instead of the keys alone it
+// returns a Match for every result, best ones first.
+//
+// Arugments:
+// query (string): the base key
+// threshold (int): how far can a candidate be in the Levenshtein metric space
+// maxResults (int): the maximum number of results which will be returned
+//
+// Returns: ([]Match) the keys found along with their values and scores
+func (service Service) QueryResults(query string, threshold, maxResults int) []Match {
+	return service.QueryMetric(query, Levenshtein, threshold, maxResults)
+}
+
+// QueryMetric works just like QueryResults, but compares the keys using the
+// given metric instead of the Levenshtein distance. If the service has a cost
+// model, the threshold bounds the total cost of the edits. Similarity metrics
+// do not count edits, so a threshold means nothing to them and they find no
+// keys: they are queried with QuerySimilarity instead. Services with a
+// phonetic encoder also return the keys sounding like the query beyond the
+// threshold, after the others.
+//
+// Arugments:
+// query (string): the base key
+// metric (Metric): the edit distance used to compare keys
+// threshold (int): how far can a candidate be in the metric space
+// maxResults (int): the maximum number of results which will be returned
+//
+// Returns: ([]Match) the keys found along with their values and scores
+func (service Service) QueryMetric(query string, metric Metric, threshold, maxResults int) []Match {
+	if metric == JaroWinkler {
+		return []Match{}
+	}
+	query = service.normalize(query)
+	distanceThreshold := metric.distance(service.options.Costs)
+	// The length buckets and the histograms bound the number of edits, so
+	// with a cost model they must allow as many edits as fit in the threshold.
+	// Models with edits costing nothing do not bound them at all, so every
+	// length is scanned without filtering by histogram.
+	edits := threshold
+	if service.options.Costs != nil {
+		edits = levenshtein.MaxEdits(float64(threshold), service.options.Costs)
+	}
 	h := new(keyScoreHeap)
 	heap.Init(h)
 	queryHistogram := levenshtein.ComputeHistogram(query)
 	queryExtended := levenshtein.ComputeExtendedHistogram(query)
-	queryLen := len(query)
+	queryLen := utf8.RuneCountInString(query)
 	heapMutex := &sync.Mutex{}
 	syncChannel := make(chan int)
-	start := queryLen - threshold
-	stop := queryLen + threshold + 1
 
 	service.rwmutex.RLock()
-	for i := start; i < stop; i++ {
+	var lengths []int
+	if edits < 0 {
+		for length := range service.dictionary {
+			lengths = append(lengths, length)
+		}
+	} else {
+		for length := queryLen - edits; length <= queryLen+edits; length++ {
+			lengths = append(lengths, length)
+		}
+	}
+	for _, length := range lengths {
 		go func(index int, mutex *sync.Mutex) {
+			// Every goroutine reuses its own matcher for all of its keys,
+			// once one of them gets past the histograms
+			var matcher *levenshtein.Matcher
 			diff := abs(index - queryLen)
 			for histogram, list := range service.dictionary[index] {
-				if levenshtein.LowerBound(queryHistogram, histogram, diff) > threshold {
+				if edits >= 0 && levenshtein.LowerBound(queryHistogram, histogram, diff) > edits {
 					continue
 				}
 				for _, pair := range list {
-					if levenshtein.ExtendedLowerBound(queryExtended, pair.extended, diff) > threshold {
+					if edits >= 0 && levenshtein.ExtendedLowerBound(queryExtended, pair.extended, diff) > edits {
 						continue
 					}
-					distance, within := levenshtein.DistanceThreshold(query, pair.key, threshold)
+					if matcher == nil {
+						matcher = getMatcher(query)
+					}
+					distance, within := distanceThreshold(matcher, pair.key, float64(threshold))
 					if within {
 						mutex.Lock()
-						heap.Push(h, keyScore{prefix(pair.key, query), distance, pair.key})
+						heap.Push(h, keyScore{prefix(pair.key, query), distance, pair.original, pair.values, false})
 						if h.Len() > maxResults {
 							heap.Pop(h)
 						}
@@ -269,18 +616,24 @@ func (service Service) Query(query string, threshold, maxResults int) []string {
 					}
 				}
 			}
+			if matcher != nil {
+				matchers.Put(matcher)
+			}
 			syncChannel <- 1
-		}(i, heapMutex)
+		}(length, heapMutex)
 	}
-	for i := start; i < stop; i++ {
+	for range lengths {
 		<-syncChannel
 	}
 	service.rwmutex.RUnlock()
 
 	sort.Sort(h)
-	results := make([]string, h.Len())
+	results := make([]Match, h.Len())
 	for i := 0; i < len(results); i++ {
-		results[i] = h.Pop().(keyScore).key
+		results[i] = service.match(h.Pop().(keyScore))
 	}
-	return results
+	return service.withSounds(query, results, maxResults, func(matcher *levenshtein.Matcher, key string) float64 {
+		distance, _ := distanceThreshold(matcher, key, unbounded)
+		return distance
+	})
 }
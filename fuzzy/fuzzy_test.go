@@ -6,9 +6,11 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"reflect"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -20,7 +22,7 @@ func TestkeyScoreHeap(t *testing.T) {
 	heap.Push(h, keyScore{key: "test", score: 3})
 	heap.Push(h, keyScore{key: "test", score: 4})
 
-	order := []int{4, 3, 1, 0}
+	order := []float64{4, 3, 1, 0}
 
 	for _, val := range order {
 		popped := heap.Pop(h).(keyScore)
@@ -126,6 +128,76 @@ func TestService(t *testing.T) {
 	}
 }
 
+func TestServiceQueryResults(t *testing.T) {
+	service := NewService()
+	service.Set("super", "ceva")
+	service.Set("supret", "altceva")
+	service.Set("supretar", "altceva")
+
+	result := service.QueryResults("supre", 3, 2)
+	if len(result) != 2 {
+		t.Log(result)
+		t.Fatal("Failed to return the expected number of matches")
+	}
+	expected := []Match{
+		{Key: "supret", Value: "altceva", Distance: 1, Prefix: 5},
+		{Key: "supretar", Value: "altceva", Distance: 3, Prefix: 5},
+	}
+	for i, match := range expected {
+		if !reflect.DeepEqual(result[i], match) {
+			t.Log(result[i], "should be", match)
+			t.Error("Failed to return the proper match")
+		}
+	}
+}
+
+func TestServiceUnicode(t *testing.T) {
+	service := NewService()
+	service.Set("café", "coffee")
+	service.Set("cafés", "coffees")
+	service.Set("élève", "pupil")
+	service.Set("日本語", "japanese")
+
+	value, present := service.Get("café")
+	if !present || value != "coffee" {
+		t.Error("Failed to get a multi-byte key")
+	}
+
+	result := service.Query("cafe", 2, 2)
+	if len(result) != 2 || result[0] != "café" || result[1] != "cafés" {
+		t.Log(result)
+		t.Error("Multi-byte keys are not within rune distance")
+	}
+
+	result = service.Query("eleve", 2, 1)
+	if len(result) != 1 || result[0] != "élève" {
+		t.Log(result)
+		t.Error("Accented key should be at distance 2")
+	}
+
+	result = service.Query("日本", 1, 1)
+	if len(result) != 1 || result[0] != "日本語" {
+		t.Log(result)
+		t.Error("Failed to query a multi-byte key by rune length")
+	}
+
+	if !service.Delete("élève") {
+		t.Error("Failed to delete a multi-byte key")
+	}
+	if _, present = service.Get("élève"); present {
+		t.Error("Multi-byte key present after delete")
+	}
+}
+
+func TestPrefixUnicode(t *testing.T) {
+	if prefix("éléphant", "élève") != 2 {
+		t.Error("Common prefix should be counted in runes")
+	}
+	if prefix("café", "cafe") != 3 {
+		t.Error("Common prefix should stop at the first different rune")
+	}
+}
+
 const testFile = "../test/data/testset_300000.dat"
 
 func TestConcurrencyService(t *testing.T) {
@@ -265,3 +337,70 @@ func BenchmarkSequentialServiceQuery(b *testing.B) {
 		b.StartTimer()
 	}
 }
+
+func TestServiceSize(t *testing.T) {
+	service := NewService()
+	if service.Size() != 0 {
+		t.Error("Empty service should have no size")
+	}
+	service.Set("ana", "super")
+	size := service.Size()
+	if size < len("ana")+len("super") {
+		t.Error("Size should account for every key and value", size)
+	}
+	service.Set("ana", "superb")
+	if service.Size() != size+1 {
+		t.Error("Size should follow the length of the values", service.Size(), size)
+	}
+	service.Delete("ana")
+	if service.Size() != 0 {
+		t.Error("Size should not account for deleted keys")
+	}
+}
+
+func TestServiceLen(t *testing.T) {
+	service := NewService()
+	/* Anagrams share their length and histogram */
+	for _, key := range []string{"stop", "pots", "tops", "spot", "opts", "post", "ana"} {
+		service.Set(key, "")
+	}
+	service.Set("pots", "again")
+	if service.Len() != 7 {
+		t.Error("Len counted", service.Len(), "keys instead of 7")
+	}
+	service.Delete("tops")
+	service.Delete("missing")
+	if service.Len() != 6 {
+		t.Error("Len counted", service.Len(), "keys instead of 6")
+	}
+
+	stats := service.Stats()
+	if stats.Keys != 6 || stats.LengthBuckets != 2 || stats.Buckets != 2 || stats.LongestChain != 5 {
+		t.Log(stats)
+		t.Error("Failed to describe the index")
+	}
+	if stats.Memory < service.Size() {
+		t.Error("Memory estimate should cover the keys and values")
+	}
+}
+
+func TestServiceLenConcurrent(t *testing.T) {
+	service := NewService()
+	var wait sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wait.Add(1)
+		go func(i int) {
+			for j := 0; j < 100; j++ {
+				key := strconv.Itoa(j)
+				service.Set(key, "")
+				service.Set(key+"-"+strconv.Itoa(i), "")
+				service.Delete(key + "-" + strconv.Itoa(i))
+			}
+			wait.Done()
+		}(i)
+	}
+	wait.Wait()
+	if service.Len() != 100 || service.Stats().Keys != 100 {
+		t.Error("Len counted", service.Len(), "keys instead of 100")
+	}
+}
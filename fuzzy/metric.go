@@ -0,0 +1,73 @@
+package fuzzy
+
+import (
+	"../levenshtein"
+)
+
+// Metric selects the edit distance, or the similarity, used to compare keys
+// in a query.
+type Metric int
+
+const (
+	// Levenshtein counts insertions, deletions and substitutions
+	Levenshtein Metric = iota
+	// Damerau also counts swapping two adjacent characters as a single
+	// edit, following the Optimal String Alignment distance
+	Damerau
+	// JaroWinkler is a similarity rather than a distance, which favours keys
+	// sharing their first characters with the query and suits short strings
+	// such as names
+	JaroWinkler
+)
+
+var metricNames = []string{
+	Levenshtein: "levenshtein",
+	Damerau:     "damerau",
+	JaroWinkler: "jarowinkler",
+}
+
+// ParseMetric returns the metric with the given name.
+//
+// Arguments:
+// name (string): the name of the metric, as returned by String
+//
+// Returns: (Metric, bool) the metric and whether the name is known
+func ParseMetric(name string) (Metric, bool) {
+	for metric, metricName := range metricNames {
+		if metricName == name {
+			return Metric(metric), true
+		}
+	}
+	return Levenshtein, false
+}
+
+func (metric Metric) String() string {
+	if metric < 0 || int(metric) >= len(metricNames) {
+		return "unknown"
+	}
+	return metricNames[metric]
+}
+
+// distance returns the function computing the metric within a threshold,
+// from the query of a matcher to a key, with every edit weighted by costs
+// unless it is nil
+func (metric Metric) distance(costs levenshtein.CostModel) func(matcher *levenshtein.Matcher, target string, threshold float64) (float64, bool) {
+	if costs != nil {
+		weighted := (*levenshtein.Matcher).WeightedDistanceThreshold
+		if metric == Damerau {
+			weighted = (*levenshtein.Matcher).WeightedDamerauThreshold
+		}
+		return func(matcher *levenshtein.Matcher, target string, threshold float64) (float64, bool) {
+			return weighted(matcher, target, threshold, costs)
+		}
+	}
+
+	unit := (*levenshtein.Matcher).DistanceThreshold
+	if metric == Damerau {
+		unit = (*levenshtein.Matcher).DamerauThreshold
+	}
+	return func(matcher *levenshtein.Matcher, target string, threshold float64) (float64, bool) {
+		distance, within := unit(matcher, target, int(threshold))
+		return float64(distance), within
+	}
+}
@@ -0,0 +1,124 @@
+package fuzzy
+
+import (
+	"../levenshtein"
+	"testing"
+)
+
+func TestParseMetric(t *testing.T) {
+	for _, metric := range []Metric{Levenshtein, Damerau, JaroWinkler} {
+		parsed, valid := ParseMetric(metric.String())
+		if !valid || parsed != metric {
+			t.Log(metric)
+			t.Error("Failed to parse the name of a metric")
+		}
+	}
+	if _, valid := ParseMetric("hamming"); valid {
+		t.Error("Unknown metric should not be parsed")
+	}
+}
+
+func TestServiceDamerau(t *testing.T) {
+	service := NewService()
+	service.Set("the", "article")
+	service.Set("tea", "drink")
+	service.Set("then", "adverb")
+
+	result := service.QueryMetric("teh", Damerau, 1, 5)
+	if len(result) != 2 || result[0].Key != "tea" || result[1].Key != "the" || result[1].Distance != 1 {
+		t.Log(result)
+		t.Error("Transposition should count as a single edit")
+	}
+
+	result = service.QueryMetric("teh", Levenshtein, 1, 5)
+	if len(result) != 1 || result[0].Key != "tea" {
+		t.Log(result)
+		t.Error("Transposition should count as two edits with Levenshtein")
+	}
+}
+
+func TestServiceJaroWinkler(t *testing.T) {
+	service := NewServiceWithOptions(Options{Normalizer: Lowercase})
+	service.Set("Martha", "1")
+	service.Set("Marhta", "2")
+	service.Set("Dwayne", "3")
+	service.Set("Duane", "4")
+	service.Set("Martha Stewart", "5")
+
+	result := service.QuerySimilarity("MARTHA", 0.9, 5)
+	if len(result) != 2 || result[0].Key != "Martha" || result[0].Distance != 0 ||
+		result[1].Key != "Marhta" || result[1].Prefix != 3 {
+		t.Log(result)
+		t.Error("Similarity query should rank the keys by their similarity")
+	}
+	if similarity := 1 - result[1].Distance; similarity < 0.961 || similarity > 0.962 {
+		t.Error("Similarity of the transposed key should be 0.961, not", similarity)
+	}
+
+	/* Ranking ignores the common prefix, which the similarity rewards already */
+	service.Set("Jonas", "6")
+	service.Set("Johnathan", "7")
+	result = service.QuerySimilarity("jonathan", 0.8, 5)
+	if len(result) != 2 || result[0].Key != "Johnathan" || result[1].Key != "Jonas" || result[1].Prefix != 4 {
+		t.Log(result)
+		t.Error("Similarity query should rank the keys by their similarity alone")
+	}
+
+	result = service.QueryMetric("dwane", JaroWinkler, 5, 1)
+	if len(result) != 0 {
+		t.Log(result)
+		t.Error("Query with the Jaro-Winkler metric should not take a threshold for a similarity")
+	}
+	if len(service.QuerySimilarity("zzz", 0.5, 5)) != 0 {
+		t.Error("Similarity query should leave out the keys below the minimum similarity")
+	}
+}
+
+func TestServiceCosts(t *testing.T) {
+	costs := levenshtein.NewKeyboardCosts(levenshtein.QWERTY, 0.5)
+	costs.Insertion = 0.5
+	service := NewServiceWithOptions(Options{Costs: costs})
+	service.Set("quick", "fast")
+	service.Set("quickly", "fast")
+	service.Set("quack", "duck")
+
+	/* Two substitutions of neighbouring keys fit in a threshold of 1 */
+	result := service.QueryMetric("qiicl", Levenshtein, 1, 5)
+	if len(result) != 1 || result[0].Key != "quick" || result[0].Distance != 1 {
+		t.Log(result)
+		t.Error("Failed to weight substitutions of neighbouring keys")
+	}
+
+	/* Cheap insertions reach keys two runes longer than the query */
+	result = service.QueryMetric("quick", Levenshtein, 1, 5)
+	if len(result) != 3 || result[0].Key != "quick" || result[1].Key != "quickly" || result[1].Distance != 1 {
+		t.Log(result)
+		t.Error("Length buckets should allow every edit fitting in the threshold")
+	}
+
+	result = service.QueryMetric("qiuck", Damerau, 1, 5)
+	if len(result) != 1 || result[0].Key != "quick" || result[0].Distance != 1 {
+		t.Log(result)
+		t.Error("Failed to weight transpositions")
+	}
+
+	/* The same keys are out of reach without the cost model */
+	if result := NewService().QueryMetric("qiicl", Levenshtein, 1, 5); len(result) != 0 {
+		t.Error("Unit costs should not find keys two edits away")
+	}
+}
+
+func TestServiceFreeEdits(t *testing.T) {
+	/* Substituting neighbouring keys is free, which does not bound the
+	   number of edits within the threshold */
+	service := NewServiceWithOptions(Options{Costs: levenshtein.NewKeyboardCosts(levenshtein.QWERTY, 0)})
+	service.Set("abc", "exact")
+	service.Set("sbx", "neighbours")
+	service.Set("abcdef", "longer")
+
+	result := service.QueryResults("abc", 1, 5)
+	if len(result) != 2 || result[0].Key != "abc" || result[1].Key != "sbx" || result[1].Distance != 0 {
+		t.Log(result)
+		t.Error("Free edits should not prevent keys from being found")
+	}
+}
@@ -0,0 +1,96 @@
+package fuzzy
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMultimap(t *testing.T) {
+	service := NewServiceWithOptions(Options{Multimap: true})
+	service.Set("widget", "SKU-1")
+	service.Set("widget", "SKU-2")
+	service.Set("widget", "SKU-1")
+	service.Set("gadget", "SKU-3")
+
+	values, present := service.GetAll("widget")
+	if !present || len(values) != 2 || values[0] != "SKU-1" || values[1] != "SKU-2" {
+		t.Log(values)
+		t.Error("Set should add every distinct value to the key")
+	}
+	if value, _ := service.Get("widget"); value != "SKU-1" {
+		t.Error("Get should return the first value of the key")
+	}
+
+	result := service.QueryResults("widgets", 1, 5)
+	if len(result) != 1 || result[0].Value != "SKU-1" || len(result[0].Values) != 2 || result[0].Values[1] != "SKU-2" {
+		t.Log(result)
+		t.Error("Query should return every value of the key")
+	}
+
+	/* The values we get must not alias the ones of the service */
+	values[0] = "changed"
+	if value, _ := service.Get("widget"); value != "SKU-1" {
+		t.Error("GetAll shares its values with the service")
+	}
+
+	if service.DeleteValue("widget", "SKU-4") || service.DeleteValue("gizmo", "SKU-1") {
+		t.Error("Deleted a missing pair")
+	}
+	if !service.DeleteValue("widget", "SKU-1") {
+		t.Error("Failed to delete a pair")
+	}
+	if values, _ = service.GetAll("widget"); len(values) != 1 || values[0] != "SKU-2" {
+		t.Log(values)
+		t.Error("Deleting a pair should keep the other values")
+	}
+	if !service.DeleteValue("widget", "SKU-2") {
+		t.Error("Failed to delete the last pair")
+	}
+	if _, present = service.Get("widget"); present {
+		t.Error("Key present after deleting its last value")
+	}
+	if _, present = service.Get("gadget"); !present {
+		t.Error("Deleting a pair removed another key")
+	}
+}
+
+func TestSingleValue(t *testing.T) {
+	service := NewService()
+	service.Set("widget", "SKU-1")
+	service.Set("widget", "SKU-2")
+	if values, _ := service.GetAll("widget"); len(values) != 1 || values[0] != "SKU-2" {
+		t.Log(values)
+		t.Error("Set should replace the value outside of multimap services")
+	}
+	if result := service.QueryResults("widget", 0, 1); len(result) != 1 || result[0].Values != nil {
+		t.Log(result)
+		t.Error("Only multimap services should list the values of a match")
+	}
+	if service.DeleteValue("widget", "SKU-1") || !service.DeleteValue("widget", "SKU-2") {
+		t.Error("DeleteValue should only delete the value of the key")
+	}
+}
+
+func TestSnapshotMultimap(t *testing.T) {
+	options := Options{Multimap: true}
+	service := NewServiceWithOptions(options)
+	service.Set("widget", "SKU-1")
+	service.Set("widget", "SKU-2")
+	service.Set("gadget", "SKU-3")
+
+	var buffer bytes.Buffer
+	service.WriteSnapshot(&buffer)
+	restored, err := ReadSnapshot(&buffer, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, _ := restored.GetAll("widget")
+	if len(values) != 2 || values[0] != "SKU-1" || values[1] != "SKU-2" {
+		t.Log(values)
+		t.Error("Restored service lost values")
+	}
+	restored.Set("widget", "SKU-4")
+	if values, _ = restored.GetAll("widget"); len(values) != 3 {
+		t.Error("Restored service is no longer a multimap")
+	}
+}
@@ -0,0 +1,101 @@
+package fuzzy
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Normalizer transforms keys before they are indexed or looked up, so that
+// keys which only differ in ways the normalizer removes are the same key.
+type Normalizer func(string) string
+
+// Lowercase maps every letter to its lower case.
+func Lowercase(s string) string {
+	return strings.ToLower(s)
+}
+
+// StripAccents replaces every rune by its Unicode compatibility decomposition
+// (NFKD) and drops the combining marks, so "PÂRIS" becomes "PARIS" and the
+// "ﬁ" ligature becomes "fi".
+func StripAccents(s string) string {
+	var builder strings.Builder
+	builder.Grow(len(s))
+	for _, r := range s {
+		if decomposition, present := decompositions[r]; present {
+			builder.WriteString(decomposition)
+		} else if !unicode.Is(unicode.Mn, r) {
+			builder.WriteRune(r)
+		}
+	}
+	return builder.String()
+}
+
+// CollapseWhitespace trims the string and replaces every run of whitespace
+// inside it by a single space.
+func CollapseWhitespace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// RemovePunctuation drops every punctuation rune.
+func RemovePunctuation(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsPunct(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+var normalizerNames = map[string]Normalizer{
+	"lowercase":   Lowercase,
+	"accents":     StripAccents,
+	"whitespace":  CollapseWhitespace,
+	"punctuation": RemovePunctuation,
+}
+
+// normalizerOrder is the order in which named normalizers are applied, so that
+// the whitespace left behind by removed punctuation still gets collapsed
+var normalizerOrder = []string{"accents", "lowercase", "punctuation", "whitespace"}
+
+// NamedNormalizer returns a Normalizer applying the normalizers of this
+// package with the given names: "accents", "lowercase", "punctuation" and
+// "whitespace". They are always applied in this order, whatever the order
+// of the names.
+//
+// Arguments:
+// names ([]string): the names of the normalizers
+//
+// Returns: (Normalizer, error) the combined normalizer, or an error if one
+// of the names is not known
+func NamedNormalizer(names []string) (Normalizer, error) {
+	requested := make(map[string]bool)
+	for _, name := range names {
+		if _, present := normalizerNames[name]; !present {
+			return nil, fmt.Errorf("unknown normalizer %q", name)
+		}
+		requested[name] = true
+	}
+	var normalizers []Normalizer
+	for _, name := range normalizerOrder {
+		if requested[name] {
+			normalizers = append(normalizers, normalizerNames[name])
+		}
+	}
+	return Chain(normalizers...), nil
+}
+
+// Chain returns a Normalizer applying every given normalizer in order.
+//
+// Arguments:
+// normalizers (...Normalizer): the normalizers to apply
+//
+// Returns: (Normalizer) the combined normalizer
+func Chain(normalizers ...Normalizer) Normalizer {
+	return func(s string) string {
+		for _, normalizer := range normalizers {
+			s = normalizer(s)
+		}
+		return s
+	}
+}
@@ -0,0 +1,90 @@
+package fuzzy
+
+import (
+	"testing"
+)
+
+func TestNormalizers(t *testing.T) {
+	var testCases = []struct {
+		normalizer Normalizer
+		input      string
+		output     string
+	}{
+		{Lowercase, "PÂRIS", "pâris"},
+		{StripAccents, "PÂRIS", "PARIS"},
+		{StripAccents, "élève à l'hôpital", "eleve a l'hopital"},
+		{StripAccents, "été", "ete"},
+		{StripAccents, "ﬁnal ２", "final 2"},
+		{StripAccents, "straße", "straße"},
+		{CollapseWhitespace, "  saint \t\n denis ", "saint denis"},
+		{RemovePunctuation, "saint-denis, l'île!", "saintdenis lîle"},
+	}
+	for _, testCase := range testCases {
+		if output := testCase.normalizer(testCase.input); output != testCase.output {
+			t.Log(testCase.input, "normalized as", output, ", should be", testCase.output)
+			t.Error("Failed to normalize")
+		}
+	}
+}
+
+func TestNamedNormalizer(t *testing.T) {
+	normalizer, err := NamedNormalizer([]string{"whitespace", "punctuation", "lowercase", "accents"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output := normalizer(" Saint - Étienne "); output != "saint etienne" {
+		t.Log(output)
+		t.Error("Named normalizers should be applied in a fixed order")
+	}
+
+	normalizer, err = NamedNormalizer(nil)
+	if err != nil || normalizer("PÂRIS") != "PÂRIS" {
+		t.Error("No normalizer should leave keys unchanged")
+	}
+
+	if _, err = NamedNormalizer([]string{"lowercase", "stemming"}); err == nil {
+		t.Error("Unknown normalizer should not be accepted")
+	}
+}
+
+func TestServiceNormalizer(t *testing.T) {
+	normalizer, _ := NamedNormalizer([]string{"lowercase", "accents"})
+	service := NewServiceWithOptions(Options{Normalizer: normalizer})
+	service.Set("PÂRIS", "capital")
+
+	for _, key := range []string{"Paris", "paris", "PÂRIS", "pâris"} {
+		if value, present := service.Get(key); !present || value != "capital" {
+			t.Log(key)
+			t.Error("Failed to get a key with a different case or accents")
+		}
+	}
+
+	result := service.QueryResults("Pâriss", 1, 5)
+	if len(result) != 1 || result[0].Key != "PÂRIS" || result[0].Distance != 1 || result[0].Prefix != 5 {
+		t.Log(result)
+		t.Error("Query should compare normalized keys and show the original one")
+	}
+
+	/* Setting an equivalent key replaces both the value and the shown key */
+	service.Set("Paris", "city")
+	if service.Len() != 1 {
+		t.Error("Equivalent keys should be the same key")
+	}
+	result = service.QueryResults("paris", 0, 5)
+	if len(result) != 1 || result[0].Key != "Paris" || result[0].Value != "city" {
+		t.Log(result)
+		t.Error("Failed to update the original key")
+	}
+
+	if result = service.PrefixQuery("PAR", 0, 5); len(result) != 1 || result[0].Key != "Paris" {
+		t.Log(result)
+		t.Error("Prefix queries should be normalized as well")
+	}
+
+	if !service.Delete("PARIS") {
+		t.Error("Failed to delete a key with a different case")
+	}
+	if _, present := service.Get("Paris"); present {
+		t.Error("Key present after delete")
+	}
+}
@@ -0,0 +1,147 @@
+package fuzzy
+
+import (
+	"../levenshtein"
+	"../phonetic"
+	"math"
+	"sort"
+	"unsafe"
+)
+
+/* Services with a phonetic encoder keep, next to the dictionary, the keys
+   sounding like every phonetic code. Queries look the codes of the query up
+   there, which finds the keys spelled far from it but pronounced alike, such
+   as "physique" for "fizzik", in a single map lookup. */
+
+// The kinds of the matches of services with a phonetic encoder
+const (
+	// SpellingMatch is a key within the threshold of the query
+	SpellingMatch = "spelling"
+	// SoundMatch is a key sounding like the query, but beyond its threshold
+	SoundMatch = "sound"
+	// SpellingAndSoundMatch is a key within the threshold of the query which
+	// also sounds like it
+	SpellingAndSoundMatch = "spelling+sound"
+)
+
+// unbounded is a threshold no distance between two keys reaches
+const unbounded = math.MaxInt32
+
+// encode returns the phonetic codes of a normalized key, or nil if the
+// service has no phonetic encoder
+func (service Service) encode(key string) []string {
+	if service.options.Phonetic == nil {
+		return nil
+	}
+	return phonetic.Encode(service.options.Phonetic, key)
+}
+
+// addSounds indexes a new key under its phonetic codes. The caller must hold
+// the write lock.
+func (service Service) addSounds(key string, codes []string) {
+	for _, code := range codes {
+		service.sounds[code] = append(service.sounds[code], key)
+	}
+}
+
+// removeSounds removes a key from the keys sounding like its phonetic codes.
+// The caller must hold the write lock.
+func (service Service) removeSounds(key string) {
+	for _, code := range service.encode(key) {
+		keys := service.sounds[code]
+		index := indexOf(keys, key)
+		if index < 0 {
+			continue
+		}
+		if len(keys) == 1 {
+			delete(service.sounds, code)
+			continue
+		}
+		keys[index] = keys[len(keys)-1]
+		service.sounds[code] = keys[:len(keys)-1]
+	}
+}
+
+// indexSounds indexes every key of the dictionary under its phonetic codes,
+// for a service whose dictionary was filled directly
+func (service Service) indexSounds() {
+	if service.options.Phonetic == nil {
+		return
+	}
+	for _, bucket := range service.dictionary {
+		for _, list := range bucket {
+			for _, pair := range list {
+				service.addSounds(pair.key, service.encode(pair.key))
+			}
+		}
+	}
+}
+
+// soundsSize estimates the number of bytes taken by the phonetic codes. The
+// keys are shared with the dictionary. The caller must hold the lock.
+func (service Service) soundsSize() int {
+	size := 0
+	for code, keys := range service.sounds {
+		size += len(code) + int(unsafe.Sizeof(code)+unsafe.Sizeof(keys)) + cap(keys)*int(unsafe.Sizeof(code))
+	}
+	return size
+}
+
+// withSounds tells the kind of the matches of a normalized query in a service
+// with a phonetic encoder, and adds the keys sounding like the query which
+// were not found, up to maxResults. They come after the other matches, the
+// closest ones first, at the distance computed by distance.
+func (service Service) withSounds(query string, results []Match, maxResults int, distance func(matcher *levenshtein.Matcher, key string) float64) []Match {
+	if service.options.Phonetic == nil {
+		return results
+	}
+	found := make(map[string]int, len(results))
+	for i := range results {
+		results[i].Kind = SpellingMatch
+		found[service.normalize(results[i].Key)] = i
+	}
+
+	var candidates []storage
+	service.rwmutex.RLock()
+	for _, code := range service.encode(query) {
+		for _, key := range service.sounds[code] {
+			if i, present := found[key]; present {
+				if i >= 0 {
+					results[i].Kind = SpellingAndSoundMatch
+				}
+				continue
+			}
+			if pair, present := service.find(key); present {
+				candidates = append(candidates, pair)
+			}
+			// Keys sounding like both codes of the query are only added once
+			found[key] = -1
+		}
+	}
+	service.rwmutex.RUnlock()
+	if len(candidates) == 0 || len(results) >= maxResults {
+		return results
+	}
+
+	matcher := getMatcher(query)
+	scores := make([]keyScore, len(candidates))
+	for i, pair := range candidates {
+		scores[i] = keyScore{prefix(pair.key, query), distance(matcher, pair.key), pair.original, pair.values, false}
+	}
+	matchers.Put(matcher)
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].score != scores[j].score {
+			return scores[i].score < scores[j].score
+		}
+		return scores[i].key < scores[j].key
+	})
+	for _, score := range scores {
+		if len(results) >= maxResults {
+			break
+		}
+		match := service.match(score)
+		match.Kind = SoundMatch
+		results = append(results, match)
+	}
+	return results
+}
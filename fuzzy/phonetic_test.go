@@ -0,0 +1,107 @@
+package fuzzy
+
+import (
+	"../phonetic"
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestServicePhonetic(t *testing.T) {
+	normalizer, _ := NamedNormalizer([]string{"lowercase"})
+	options := Options{Normalizer: normalizer, Phonetic: phonetic.French{}}
+	service := NewServiceWithOptions(options)
+	service.Set("Physique", "science")
+	service.Set("fizzix", "typo")
+	service.Set("fisc", "tax")
+	service.Set("chapeau", "hat")
+
+	/* "physique" is seven edits away from "fizzik", but sounds the same */
+	result := service.QueryResults("fizzik", 1, 5)
+	if len(result) != 2 || result[0].Key != "fizzix" || result[0].Kind != SpellingMatch ||
+		result[1].Key != "Physique" || result[1].Kind != SoundMatch || result[1].Distance != 7 || result[1].Value != "science" {
+		t.Log(result)
+		t.Error("Query should find the keys sounding like the query after the others")
+	}
+
+	result = service.QueryResults("fizik", 3, 5)
+	if len(result) != 3 || result[0].Key != "fizzix" || result[0].Kind != SpellingMatch ||
+		result[1].Key != "fisc" || result[1].Kind != SpellingMatch ||
+		result[2].Key != "Physique" || result[2].Kind != SoundMatch {
+		t.Log(result)
+		t.Error("Sound matches should come after the spelling matches")
+	}
+
+	result = service.QueryResults("PHYSIQUES", 1, 5)
+	if len(result) != 1 || result[0].Key != "Physique" || result[0].Kind != SpellingAndSoundMatch {
+		t.Log(result)
+		t.Error("Keys found by both their spelling and their sound should be marked as such")
+	}
+	if result := service.QueryResults("fizzik", 1, 1); len(result) != 1 || result[0].Kind != SpellingMatch {
+		t.Log(result)
+		t.Error("Sound matches should not exceed the maximum number of results")
+	}
+	result = service.QuerySimilarity("chapo", 0.95, 5)
+	if len(result) != 1 || result[0].Key != "chapeau" || result[0].Kind != SoundMatch {
+		t.Log(result)
+		t.Error("Similarity queries should find the keys sounding like the query")
+	}
+
+	/* Token queries find the keys sounding like the query as well, prefix
+	   queries only compare the spelling */
+	service.Set("chapeau rouge", "red hat")
+	result = service.QueryTokens("chapo", 0, 0.9, 5)
+	if len(result) != 1 || result[0].Key != "chapeau" || result[0].Kind != SoundMatch || math.Abs(result[0].Distance-3.0/7) > 1e-9 {
+		t.Log(result)
+		t.Error("Token queries should find the keys sounding like the query, ranked by their ratio")
+	}
+	result = service.QueryTokens("rouge chapeau", 0, 0.9, 5)
+	if len(result) != 1 || result[0].Key != "chapeau rouge" || result[0].Kind != SpellingMatch {
+		t.Log(result)
+		t.Error("Token queries should tell the kind of their matches")
+	}
+	if result := service.PrefixQuery("fizzik", 0, 5); len(result) != 0 {
+		t.Log(result)
+		t.Error("Prefix queries should not find the keys sounding like the prefix")
+	}
+	if result := service.PrefixQuery("chap", 0, 5); len(result) != 2 || result[0].Kind != SpellingMatch {
+		t.Log(result)
+		t.Error("Prefix queries should find the keys by their spelling only")
+	}
+	service.Delete("chapeau rouge")
+
+	/* Deleted keys no longer sound like anything */
+	service.Delete("physique")
+	if result := service.QueryResults("fizzik", 1, 5); len(result) != 1 {
+		t.Log(result)
+		t.Error("Deleted key was still found by its sound")
+	}
+	service.Set("physique", "science")
+
+	var buffer bytes.Buffer
+	if err := service.WriteSnapshot(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := ReadSnapshot(&buffer, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := restored.QueryResults("fizzik", 0, 5); len(result) != 1 || result[0].Key != "physique" {
+		t.Log(result)
+		t.Error("Restored service should index the sound of its keys")
+	}
+	if restored.Size() != service.Size() || restored.Stats().Memory != service.Stats().Memory {
+		t.Error("Restored service should have the same size")
+	}
+
+	/* Services without an encoder do not tell the kind of their matches */
+	plain := NewService()
+	plain.Set("physique", "science")
+	if result := plain.QueryResults("physiqe", 1, 5); len(result) != 1 || result[0].Kind != "" {
+		t.Log(result)
+		t.Error("Services without an encoder should not find keys by their sound")
+	}
+	if len(plain.QueryResults("fizzik", 1, 5)) != 0 {
+		t.Error("Services without an encoder should not find keys by their sound")
+	}
+}
@@ -0,0 +1,138 @@
+package fuzzy
+
+import (
+	"container/heap"
+	"sort"
+	"strings"
+)
+
+// Entry is a key of the service, as it was given to Set, along with the
+// value it indexes. In multimap services Values holds every value of the key
+// and Value the first one.
+type Entry struct {
+	Key    string   `json:"key"`
+	Value  string   `json:"value"`
+	Values []string `json:"values,omitempty"`
+}
+
+// sortedEntries copies every entry, sorted by indexed key. The values are
+// not copied, since the service never modifies a slice of values in place.
+func (service Service) sortedEntries() []storage {
+	var entries []storage
+	service.rwmutex.RLock()
+	for _, bucket := range service.dictionary {
+		for _, list := range bucket {
+			entries = append(entries, list...)
+		}
+	}
+	service.rwmutex.RUnlock()
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].key < entries[j].key
+	})
+	return entries
+}
+
+// entryHeap is a max-heap of entries ordered by indexed key, which keeps the
+// smallest keys seen so far by popping the largest one
+type entryHeap []storage
+
+func (h entryHeap) Len() int            { return len(h) }
+func (h entryHeap) Less(i, j int) bool  { return h[i].key > h[j].key }
+func (h entryHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *entryHeap) Push(x interface{}) { *h = append(*h, x.(storage)) }
+
+func (h *entryHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// firstEntries copies the count entries with the smallest indexed keys, all
+// of them if started is false or only those greater than after otherwise,
+// sorted by indexed key. It takes O(N log count) rather than sorting every
+// key.
+func (service Service) firstEntries(after string, started bool, count int) []storage {
+	h := make(entryHeap, 0, count+1)
+	service.rwmutex.RLock()
+	for _, bucket := range service.dictionary {
+		for _, list := range bucket {
+			for _, pair := range list {
+				if started && pair.key <= after {
+					continue
+				}
+				if len(h) == count {
+					if pair.key >= h[0].key {
+						continue
+					}
+					h[0] = pair
+					heap.Fix(&h, 0)
+					continue
+				}
+				heap.Push(&h, pair)
+			}
+		}
+	}
+	service.rwmutex.RUnlock()
+	sort.Slice(h, func(i, j int) bool {
+		return h[i].key < h[j].key
+	})
+	return h
+}
+
+// Range calls f for every key and value indexed by the system, in the order
+// of the keys, until f returns false. Keys of multimap services are given
+// once for each of their values. The keys are collected before calling f, so
+// f may modify the service, but these changes are not seen by Range.
+//
+// Arguments:
+// f (func(key, value string) bool): called for every key and value, as long
+// as it returns true
+func (service Service) Range(f func(key, value string) bool) {
+	for _, pair := range service.sortedEntries() {
+		for _, value := range pair.values {
+			if !f(pair.original, value) {
+				return
+			}
+		}
+	}
+}
+
+// cursorPrefix starts every cursor following a page, so that the cursor
+// following the empty key is not the empty cursor of the first page
+const cursorPrefix = ">"
+
+// Scan returns the keys following a cursor, in the order of the keys, so
+// that all of them can be read one page at a time. The cursor is the one
+// returned with the previous page, or the empty string for the first page.
+// Every page takes O(N log limit) for N keys.
+// Since pages are ordered by key, keys which are neither set nor deleted
+// while scanning are returned exactly once, whatever other writes happen.
+//
+// Arguments:
+// cursor (string): where the previous page ended
+// limit (int): the maximum number of keys in the page, at least 1
+//
+// Returns: ([]Entry, string) the keys of the page along with their values,
+// and the cursor of the next page, which is empty after the last page
+func (service Service) Scan(cursor string, limit int) ([]Entry, string) {
+	if limit < 1 {
+		limit = 1
+	}
+	after, started := strings.CutPrefix(cursor, cursorPrefix)
+	entries := service.firstEntries(after, started, limit+1)
+	next := ""
+	if len(entries) > limit {
+		entries = entries[:limit]
+		next = cursorPrefix + entries[limit-1].key
+	}
+
+	page := make([]Entry, len(entries))
+	for i, pair := range entries {
+		page[i] = Entry{Key: pair.original, Value: pair.values[0]}
+		if service.options.Multimap {
+			page[i].Values = append([]string(nil), pair.values...)
+		}
+	}
+	return page, next
+}
@@ -0,0 +1,150 @@
+package fuzzy
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestRange(t *testing.T) {
+	service := NewServiceWithOptions(Options{Multimap: true})
+	service.Set("super", "1")
+	service.Set("ana", "2")
+	service.Set("ana", "3")
+	service.Set("supret", "4")
+
+	var keys, values []string
+	service.Range(func(key, value string) bool {
+		keys = append(keys, key)
+		values = append(values, value)
+		return true
+	})
+	expectedKeys := []string{"ana", "ana", "super", "supret"}
+	expectedValues := []string{"2", "3", "1", "4"}
+	if len(keys) != len(expectedKeys) {
+		t.Fatal("Range returned", keys, values)
+	}
+	for i := range keys {
+		if keys[i] != expectedKeys[i] || values[i] != expectedValues[i] {
+			t.Log(keys, values)
+			t.Fatal("Range did not return the keys in order")
+		}
+	}
+
+	count := 0
+	service.Range(func(key, value string) bool {
+		count++
+		service.Set(key+"x", value)
+		return count < 2
+	})
+	if count != 2 {
+		t.Error("Range did not stop when asked to")
+	}
+}
+
+func TestScan(t *testing.T) {
+	normalizer, _ := NamedNormalizer([]string{"lowercase"})
+	service := NewServiceWithOptions(Options{Normalizer: normalizer})
+	for i := 0; i < 25; i++ {
+		service.Set("Key"+strconv.Itoa(i), strconv.Itoa(i))
+	}
+
+	seen := make(map[string]bool)
+	cursor, pages := "", 0
+	for {
+		page, next := service.Scan(cursor, 10)
+		pages++
+		for i, entry := range page {
+			if seen[entry.Key] {
+				t.Error("Scan returned a key twice", entry.Key)
+			}
+			if i > 0 && normalizer(page[i-1].Key) >= normalizer(entry.Key) {
+				t.Error("Scan did not return the keys in order")
+			}
+			if entry.Value != entry.Key[3:] {
+				t.Error("Scan returned the wrong value", entry)
+			}
+			seen[entry.Key] = true
+		}
+		if len(next) == 0 {
+			break
+		}
+		cursor = next
+	}
+	if len(seen) != 25 || pages != 3 {
+		t.Error("Scan returned", len(seen), "keys in", pages, "pages")
+	}
+	if page, next := service.Scan("", 25); len(page) != 25 || next != "" {
+		t.Error("A page holding every key should be the last one")
+	}
+}
+
+func TestScanConcurrentWrites(t *testing.T) {
+	service := NewService()
+	for i := 0; i < 1000; i++ {
+		service.Set("stable"+strconv.Itoa(i), "")
+	}
+
+	var wait sync.WaitGroup
+	wait.Add(1)
+	go func() {
+		for i := 0; i < 1000; i++ {
+			service.Set("moving"+strconv.Itoa(i), "")
+			service.Delete("moving" + strconv.Itoa(i/2))
+		}
+		wait.Done()
+	}()
+
+	seen := make(map[string]int)
+	for cursor := ""; ; {
+		page, next := service.Scan(cursor, 64)
+		for _, entry := range page {
+			seen[entry.Key]++
+		}
+		if len(next) == 0 {
+			break
+		}
+		cursor = next
+	}
+	wait.Wait()
+
+	for i := 0; i < 1000; i++ {
+		if count := seen["stable"+strconv.Itoa(i)]; count != 1 {
+			t.Fatal("Scan returned a stable key", count, "times")
+		}
+	}
+	for key, count := range seen {
+		if count != 1 {
+			t.Fatal("Scan returned", key, count, "times")
+		}
+	}
+}
+
+func TestScanEmptyKey(t *testing.T) {
+	normalizer, _ := NamedNormalizer([]string{"punctuation"})
+	service := NewServiceWithOptions(Options{Normalizer: normalizer})
+	service.Set("?!", "empty")
+	service.Set("a", "letter")
+	if service.Len() != 2 {
+		t.Fatal("Service should hold both keys")
+	}
+
+	count := 0
+	service.Range(func(key, value string) bool {
+		count++
+		return true
+	})
+	if count != 2 {
+		t.Error("Range returned", count, "keys instead of 2")
+	}
+
+	/* The key normalized as the empty string ends the first page */
+	page, next := service.Scan("", 1)
+	if len(page) != 1 || page[0].Value != "empty" || len(next) == 0 {
+		t.Fatal("First page should hold the empty key", page, next)
+	}
+	page, next = service.Scan(next, 1)
+	if len(page) != 1 || page[0].Value != "letter" || next != "" {
+		t.Error("Second page should hold the other key", page, next)
+	}
+}
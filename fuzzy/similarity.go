@@ -0,0 +1,77 @@
+package fuzzy
+
+import (
+	"../levenshtein"
+	"container/heap"
+	"sort"
+	"sync"
+	"unicode/utf8"
+)
+
+// DefaultMinSimilarity is the minimum similarity of the results of the
+// similarity queries which do not give one
+const DefaultMinSimilarity = 0.8
+
+// QuerySimilarity queries the service for the keys whose Jaro-Winkler
+// similarity to a query is at least a minimum similarity, the most similar
+// ones first. The cost model of the service, if any, does not apply. Services
+// with a phonetic encoder also return the keys sounding like the query below
+// the minimum similarity, after the others.
+//
+// Arugments:
+// query (string): the base key
+// minSimilarity (float64): the minimum similarity of the results, between 0
+// and 1
+// maxResults (int): the maximum number of results which will be returned
+//
+// Returns: ([]Match) the keys found along with their values, with 1 minus
+// their similarity as their distance
+func (service Service) QuerySimilarity(query string, minSimilarity float64, maxResults int) []Match {
+	query = service.normalize(query)
+	h := new(keyScoreHeap)
+	heap.Init(h)
+	queryLen := utf8.RuneCountInString(query)
+	heapMutex := &sync.Mutex{}
+	var wait sync.WaitGroup
+
+	service.rwmutex.RLock()
+	for length, bucket := range service.dictionary {
+		// Keys of this length can not be similar enough, whatever their
+		// content. The histograms bound edit distances, not similarities,
+		// so they are of no use here.
+		if levenshtein.MaxJaroWinkler(queryLen, length) < minSimilarity {
+			continue
+		}
+		wait.Add(1)
+		go func(bucket map[uint32][]storage, mutex *sync.Mutex) {
+			matcher := getMatcher(query)
+			for _, list := range bucket {
+				for _, pair := range list {
+					similarity, within := matcher.JaroWinklerThreshold(pair.key, minSimilarity)
+					if within {
+						mutex.Lock()
+						heap.Push(h, keyScore{prefix(pair.key, query), 1 - similarity, pair.original, pair.values, true})
+						if h.Len() > maxResults {
+							heap.Pop(h)
+						}
+						mutex.Unlock()
+					}
+				}
+			}
+			matchers.Put(matcher)
+			wait.Done()
+		}(bucket, heapMutex)
+	}
+	wait.Wait()
+	service.rwmutex.RUnlock()
+
+	sort.Sort(h)
+	results := make([]Match, h.Len())
+	for i := 0; i < len(results); i++ {
+		results[i] = service.match(h.Pop().(keyScore))
+	}
+	return service.withSounds(query, results, maxResults, func(matcher *levenshtein.Matcher, key string) float64 {
+		similarity, _ := matcher.JaroWinklerThreshold(key, 0)
+		return 1 - similarity
+	})
+}
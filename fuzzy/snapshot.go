@@ -0,0 +1,318 @@
+package fuzzy
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// A snapshot starts with a magic string and a format version, followed by
+// the length buckets of the dictionary. Every bucket holds its histograms and
+// every histogram the keys, values and extended histograms indexed by it, so
+// that loading a snapshot does not have to compute any histogram again.
+// Every key is followed by its original form, which is left empty when it is
+// the same as the key, and by the number of values it indexes.
+// All counts and string lengths are written as unsigned varints and the file
+// ends with the CRC32 checksum of everything that precedes it.
+const snapshotMagic = "FZGY"
+const snapshotVersion = 1
+
+// ErrCorruptSnapshot is returned when a snapshot can not be decoded.
+var ErrCorruptSnapshot = errors.New("fuzzy: corrupt snapshot")
+
+type snapshotWriter struct {
+	writer *bufio.Writer
+	hash   io.Writer
+	buffer [binary.MaxVarintLen64]byte
+	err    error
+}
+
+func (s *snapshotWriter) write(data []byte) {
+	if s.err != nil {
+		return
+	}
+	if _, s.err = s.writer.Write(data); s.err == nil {
+		s.hash.Write(data)
+	}
+}
+
+func (s *snapshotWriter) uvarint(x uint64) {
+	n := binary.PutUvarint(s.buffer[:], x)
+	s.write(s.buffer[:n])
+}
+
+func (s *snapshotWriter) uint32(x uint32) {
+	binary.LittleEndian.PutUint32(s.buffer[:4], x)
+	s.write(s.buffer[:4])
+}
+
+func (s *snapshotWriter) uint64(x uint64) {
+	binary.LittleEndian.PutUint64(s.buffer[:8], x)
+	s.write(s.buffer[:8])
+}
+
+func (s *snapshotWriter) string(x string) {
+	s.uvarint(uint64(len(x)))
+	s.write([]byte(x))
+}
+
+// WriteSnapshot serializes the whole content of the service to a writer in
+// a compact binary format which can be loaded back with ReadSnapshot.
+//
+// Arguments:
+// w (io.Writer): where the snapshot is written
+//
+// Returns: (error) the first error encountered while writing, if any
+func (service Service) WriteSnapshot(w io.Writer) error {
+	hash := crc32.NewIEEE()
+	s := &snapshotWriter{writer: bufio.NewWriter(w), hash: hash}
+
+	service.rwmutex.RLock()
+	s.write([]byte(snapshotMagic))
+	s.uvarint(snapshotVersion)
+	s.uvarint(uint64(len(service.dictionary)))
+	for length, bucket := range service.dictionary {
+		s.uvarint(uint64(length))
+		s.uvarint(uint64(len(bucket)))
+		for histogram, list := range bucket {
+			s.uint32(histogram)
+			s.uvarint(uint64(len(list)))
+			for _, pair := range list {
+				s.uint64(pair.extended)
+				s.string(pair.key)
+				if pair.original == pair.key {
+					s.string("")
+				} else {
+					s.string(pair.original)
+				}
+				s.uvarint(uint64(len(pair.values)))
+				for _, value := range pair.values {
+					s.string(value)
+				}
+			}
+		}
+	}
+	service.rwmutex.RUnlock()
+
+	// The checksum itself is not part of the checksum
+	s.hash = io.Discard
+	s.uint32(hash.Sum32())
+	if s.err != nil {
+		return s.err
+	}
+	return s.writer.Flush()
+}
+
+type snapshotReader struct {
+	reader *bufio.Reader
+	hash   io.Writer
+	buffer [8]byte
+	err    error
+}
+
+func (s *snapshotReader) read(data []byte) {
+	if s.err != nil {
+		return
+	}
+	if _, s.err = io.ReadFull(s.reader, data); s.err == nil {
+		s.hash.Write(data)
+	}
+}
+
+func (s *snapshotReader) ReadByte() (byte, error) {
+	s.read(s.buffer[:1])
+	return s.buffer[0], s.err
+}
+
+func (s *snapshotReader) uvarint() uint64 {
+	if s.err != nil {
+		return 0
+	}
+	x, err := binary.ReadUvarint(s)
+	if err != nil && s.err == nil {
+		s.err = err
+	}
+	return x
+}
+
+// count reads a length and rejects it if it is larger than a sanity limit.
+// Callers never preallocate more than a bounded amount of memory based on
+// it, since a corrupted file may still hold a huge count below the limit.
+func (s *snapshotReader) count(limit uint64) int {
+	x := s.uvarint()
+	if x > limit && s.err == nil {
+		s.err = ErrCorruptSnapshot
+	}
+	if s.err != nil {
+		return 0
+	}
+	return int(x)
+}
+
+func (s *snapshotReader) uint32() uint32 {
+	s.read(s.buffer[:4])
+	return binary.LittleEndian.Uint32(s.buffer[:4])
+}
+
+func (s *snapshotReader) uint64() uint64 {
+	s.read(s.buffer[:8])
+	return binary.LittleEndian.Uint64(s.buffer[:8])
+}
+
+func (s *snapshotReader) string() string {
+	length := s.count(1 << 30)
+	if s.err != nil || length == 0 {
+		return ""
+	}
+	data := make([]byte, 0, min(length, 1<<16))
+	for len(data) < length && s.err == nil {
+		chunk := make([]byte, min(length-len(data), 1<<16))
+		s.read(chunk)
+		data = append(data, chunk...)
+	}
+	return string(data)
+}
+
+// ReadSnapshot creates a new service holding the content of a snapshot
+// previously written with WriteSnapshot. The options are not part of the
+// snapshot, so they must be given again.
+//
+// Arguments:
+// r (io.Reader): the reader from which the snapshot is read
+// options (Options): the settings of the restored service
+//
+// Returns: (*Service, error) the restored service, or an error if the
+// snapshot could not be read or is not valid
+func ReadSnapshot(r io.Reader, options Options) (*Service, error) {
+	hash := crc32.NewIEEE()
+	s := &snapshotReader{reader: bufio.NewReader(r), hash: hash}
+
+	magic := make([]byte, len(snapshotMagic))
+	s.read(magic)
+	if s.err == nil && string(magic) != snapshotMagic {
+		return nil, ErrCorruptSnapshot
+	}
+	version := s.uvarint()
+	if s.err == nil && version != snapshotVersion {
+		return nil, errors.New("fuzzy: unsupported snapshot version")
+	}
+
+	dict := make(map[int]map[uint32][]storage)
+	buckets := s.count(1 << 31)
+	for i := 0; i < buckets && s.err == nil; i++ {
+		length := int(s.uvarint())
+		histograms := s.count(1 << 32)
+		bucket := make(map[uint32][]storage, min(histograms, 1<<16))
+		for j := 0; j < histograms && s.err == nil; j++ {
+			histogram := s.uint32()
+			entries := s.count(1 << 32)
+			list := make([]storage, 0, min(entries, 1<<16))
+			for k := 0; k < entries && s.err == nil; k++ {
+				extended := s.uint64()
+				key := s.string()
+				original := key
+				if stored := s.string(); len(stored) != 0 {
+					original = stored
+				}
+				values := s.count(1 << 32)
+				pair := storage{key, original, make([]string, 0, min(values, 1<<16)), extended}
+				for v := 0; v < values && s.err == nil; v++ {
+					pair.values = append(pair.values, s.string())
+				}
+				if len(pair.values) == 0 && s.err == nil {
+					s.err = ErrCorruptSnapshot
+				}
+				list = append(list, pair)
+			}
+			bucket[histogram] = list
+		}
+		dict[length] = bucket
+	}
+
+	checksum := hash.Sum32()
+	s.hash = io.Discard
+	if stored := s.uint32(); s.err == nil && stored != checksum {
+		return nil, ErrCorruptSnapshot
+	}
+	if s.err == io.EOF || s.err == io.ErrUnexpectedEOF {
+		return nil, ErrCorruptSnapshot
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	service := NewServiceWithOptions(options)
+	service.dictionary = dict
+	for _, bucket := range dict {
+		for _, list := range bucket {
+			service.keys.Add(int64(len(list)))
+		}
+	}
+	service.indexSounds()
+	return service, nil
+}
+
+// SaveSnapshot writes a snapshot of the service to a file. The snapshot is
+// first written to a temporary file which then replaces the old one, so an
+// interrupted save never leaves a truncated snapshot behind. The directory is
+// synced as well, so the snapshot is durable once SaveSnapshot returns.
+//
+// Arguments:
+// path (string): the file where the snapshot is saved
+//
+// Returns: (error) any error encountered while writing the file
+func (service Service) SaveSnapshot(path string) error {
+	temporary := path + ".tmp"
+	file, err := os.Create(temporary)
+	if err != nil {
+		return err
+	}
+	err = service.WriteSnapshot(file)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(temporary)
+		return err
+	}
+	if err = os.Rename(temporary, path); err != nil {
+		return err
+	}
+	return syncDirectory(filepath.Dir(path))
+}
+
+// syncDirectory flushes the entries of a directory, such as a renamed file,
+// to stable storage
+func syncDirectory(path string) error {
+	directory, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	err = directory.Sync()
+	if closeErr := directory.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// LoadSnapshot creates a new service from a file written by SaveSnapshot.
+//
+// Arguments:
+// path (string): the snapshot file
+// options (Options): the settings of the restored service
+//
+// Returns: (*Service, error) the restored service or the error encountered
+func LoadSnapshot(path string, options Options) (*Service, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadSnapshot(file, options)
+}
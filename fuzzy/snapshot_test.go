@@ -0,0 +1,142 @@
+package fuzzy
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	service := NewService()
+	service.Set("ana", "super")
+	service.Set("anan", "value")
+	service.Set("café", "coffee")
+	service.Set("supret", "")
+	service.Set("kye", "test")
+	service.Set("key", "test")
+
+	var buffer bytes.Buffer
+	if err := service.WriteSnapshot(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := ReadSnapshot(&buffer, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if restored.Len() != service.Len() {
+		t.Error("Restored service has a different number of keys")
+	}
+	for _, key := range []string{"ana", "anan", "café", "supret", "kye", "key"} {
+		expected, _ := service.Get(key)
+		value, present := restored.Get(key)
+		if !present || value != expected {
+			t.Log(key, value, present)
+			t.Error("Restored service lost a key")
+		}
+	}
+	result := restored.Query("cafe", 1, 1)
+	if len(result) != 1 || result[0] != "café" {
+		t.Log(result)
+		t.Error("Restored service can not be queried")
+	}
+
+	/* The restored service must keep working as a regular one */
+	restored.Set("ana", "changed")
+	if value, _ := restored.Get("ana"); value != "changed" {
+		t.Error("Restored service did not record our change")
+	}
+	if value, _ := service.Get("ana"); value != "super" {
+		t.Error("Restored service shares data with the original one")
+	}
+}
+
+func TestSnapshotNormalizer(t *testing.T) {
+	normalizer, _ := NamedNormalizer([]string{"lowercase", "accents"})
+	options := Options{Normalizer: normalizer}
+	service := NewServiceWithOptions(options)
+	service.Set("PÂRIS", "capital")
+	service.Set("lyon", "city")
+
+	var buffer bytes.Buffer
+	service.WriteSnapshot(&buffer)
+	restored, err := ReadSnapshot(&buffer, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, present := restored.Get("Paris"); !present || value != "capital" {
+		t.Error("Restored service lost a normalized key")
+	}
+	result := restored.QueryResults("pari", 1, 5)
+	if len(result) != 1 || result[0].Key != "PÂRIS" {
+		t.Log(result)
+		t.Error("Restored service lost the original key")
+	}
+	result = restored.QueryResults("lyon", 0, 5)
+	if len(result) != 1 || result[0].Key != "lyon" {
+		t.Log(result)
+		t.Error("Restored service lost a key which normalizes to itself")
+	}
+}
+
+func TestSnapshotCorrupt(t *testing.T) {
+	service := NewService()
+	service.Set("ana", "super")
+	service.Set("anan", "value")
+
+	var buffer bytes.Buffer
+	if err := service.WriteSnapshot(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	data := buffer.Bytes()
+
+	if _, err := ReadSnapshot(bytes.NewReader(data[:len(data)-1]), Options{}); err == nil {
+		t.Error("Truncated snapshot should not be loaded")
+	}
+	if _, err := ReadSnapshot(bytes.NewReader(nil), Options{}); err == nil {
+		t.Error("Empty snapshot should not be loaded")
+	}
+	for i := range data {
+		corrupt := append([]byte(nil), data...)
+		corrupt[i] ^= 0x40
+		if _, err := ReadSnapshot(bytes.NewReader(corrupt), Options{}); err == nil {
+			t.Log("Flipped byte", i)
+			t.Error("Corrupted snapshot should not be loaded")
+		}
+	}
+}
+
+func TestSnapshotFile(t *testing.T) {
+	service := NewService()
+	service.Set("ana", "super")
+
+	path := filepath.Join(t.TempDir(), "store.snapshot")
+	if err := service.SaveSnapshot(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Error("Temporary snapshot file was left behind")
+	}
+	restored, err := LoadSnapshot(path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, present := restored.Get("ana"); !present || value != "super" {
+		t.Error("Failed to load the saved snapshot")
+	}
+	if _, err := LoadSnapshot(path+".missing", Options{}); err == nil {
+		t.Error("Loading a missing snapshot should fail")
+	}
+}
+
+func BenchmarkSnapshotRoundTrip(b *testing.B) {
+	_, _, service := LoadTestSet(testFile)
+	var buffer bytes.Buffer
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		buffer.Reset()
+		service.WriteSnapshot(&buffer)
+		ReadSnapshot(&buffer, Options{})
+	}
+}
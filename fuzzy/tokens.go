@@ -0,0 +1,237 @@
+package fuzzy
+
+import (
+	"../levenshtein"
+	"container/heap"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+	"unsafe"
+)
+
+/* Token queries compare the words of the query to the words of the keys
+   regardless of their order, so that "seau palpitas crecelle" finds
+   "palpitas crecelle seau". Every word of the query is matched with the
+   closest word of the key within the threshold, then the key is scored with
+   the token set ratio:
+
+   - the matched words, sorted by the words of the key, form the intersection
+     of the query and the key,
+   - each side is the intersection, spelled as in the query or as in the key,
+     followed by its other words, sorted,
+   - the ratio is the similarity between both sides.
+
+   The ratio is symmetric, and only 1 for keys holding the same words as the
+   query spelled the same. Unlike the usual token set ratio, the intersection
+   alone is not compared to the sides, which would make the keys holding
+   every word of the query, and the ones whose every word is in the query,
+   perfect matches whatever their other words. The similarity between two
+   strings is 1 minus their Levenshtein distance over the length of the
+   longest one. */
+
+// tokenScorer scores keys against the words of a query. It reuses its
+// matchers and buffers from one key to the next, so every goroutine of a
+// query needs its own.
+type tokenScorer struct {
+	words     []string
+	matchers  []*levenshtein.Matcher
+	distance  func(matcher *levenshtein.Matcher, target string, threshold float64) (float64, bool)
+	threshold float64
+	ratio     *levenshtein.Matcher
+	keyWords  []string
+	matched   []bool
+	pairs     []tokenPair
+	queryRest []string
+	keyRest   []string
+	querySide []byte
+	keySide   []byte
+}
+
+func newTokenScorer(words []string, distance func(*levenshtein.Matcher, string, float64) (float64, bool), threshold float64) *tokenScorer {
+	scorer := &tokenScorer{words: words, distance: distance, threshold: threshold, ratio: getMatcher("")}
+	for _, word := range words {
+		scorer.matchers = append(scorer.matchers, getMatcher(word))
+	}
+	return scorer
+}
+
+// release puts the matchers of the scorer back into the pool
+func (scorer *tokenScorer) release() {
+	for _, matcher := range scorer.matchers {
+		matchers.Put(matcher)
+	}
+	matchers.Put(scorer.ratio)
+}
+
+// tokenPair is a word of the query matched with a word of a key
+type tokenPair struct {
+	query, key string
+}
+
+// score computes the token set ratio between the query and a key, or returns
+// false if no word of the query is close enough to a word of the key
+func (scorer *tokenScorer) score(key string) (float64, bool) {
+	scorer.keyWords = appendDistinctWords(scorer.keyWords[:0], key)
+	keyWords := scorer.keyWords
+	if cap(scorer.matched) < len(keyWords) {
+		scorer.matched = make([]bool, len(keyWords))
+	}
+	matched := scorer.matched[:len(keyWords)]
+	for i := range matched {
+		matched[i] = false
+	}
+
+	pairs, queryRest := scorer.pairs[:0], scorer.queryRest[:0]
+	for i, word := range scorer.words {
+		best, bestDistance := -1, 0.0
+		for j, keyWord := range keyWords {
+			if matched[j] {
+				continue
+			}
+			distance, within := scorer.distance(scorer.matchers[i], keyWord, scorer.threshold)
+			if within && (best < 0 || distance < bestDistance) {
+				best, bestDistance = j, distance
+			}
+		}
+		if best < 0 {
+			queryRest = append(queryRest, word)
+			continue
+		}
+		matched[best] = true
+		pairs = append(pairs, tokenPair{word, keyWords[best]})
+	}
+	scorer.pairs, scorer.queryRest = pairs, queryRest
+	if len(pairs) == 0 {
+		return 0, false
+	}
+	keyRest := scorer.keyRest[:0]
+	for j, keyWord := range keyWords {
+		if !matched[j] {
+			keyRest = append(keyRest, keyWord)
+		}
+	}
+	scorer.keyRest = keyRest
+
+	slices.SortFunc(pairs, func(a, b tokenPair) int {
+		return strings.Compare(a.key, b.key)
+	})
+	slices.Sort(queryRest)
+	slices.Sort(keyRest)
+	scorer.querySide = scorer.querySide[:0]
+	scorer.keySide = scorer.keySide[:0]
+	for _, pair := range pairs {
+		scorer.querySide = appendWord(scorer.querySide, pair.query)
+		scorer.keySide = appendWord(scorer.keySide, pair.key)
+	}
+	for _, word := range queryRest {
+		scorer.querySide = appendWord(scorer.querySide, word)
+	}
+	for _, word := range keyRest {
+		scorer.keySide = appendWord(scorer.keySide, word)
+	}
+	return scorer.similarity(scorer.querySide, scorer.keySide), true
+}
+
+// appendWord appends a word to a buffer of words separated by spaces
+func appendWord(buffer []byte, word string) []byte {
+	if len(buffer) != 0 {
+		buffer = append(buffer, ' ')
+	}
+	return append(buffer, word...)
+}
+
+// similarity is 1 minus the Levenshtein distance between two strings over the
+// length of the longest one
+func (scorer *tokenScorer) similarity(source, target []byte) float64 {
+	length := max(utf8.RuneCount(source), utf8.RuneCount(target))
+	if length == 0 {
+		return 1
+	}
+	// The matcher decodes the strings into its own buffers and keeps neither
+	// of them, so they may share the memory of the buffers of the scorer
+	scorer.ratio.Reset(unsafe.String(unsafe.SliceData(source), len(source)))
+	distance, _ := scorer.ratio.DistanceThreshold(unsafe.String(unsafe.SliceData(target), len(target)), length)
+	return 1 - float64(distance)/float64(length)
+}
+
+// appendDistinctWords appends the words of a string to a buffer, keeping each
+// of them once
+func appendDistinctWords(buffer []string, s string) []string {
+	for word := range strings.FieldsSeq(s) {
+		if indexOf(buffer, word) < 0 {
+			buffer = append(buffer, word)
+		}
+	}
+	return buffer
+}
+
+// QueryTokens queries the service for the keys holding the words of a query,
+// in any order. Every word of the query is matched with a word of the key
+// within a threshold, using the cost model of the service if any, and the
+// keys are ranked by their token set ratio with the query, the highest first.
+// Services with a phonetic encoder also return the keys sounding like the
+// query below the minimum ratio, after the others. Their words are pronounced
+// like the ones of the query in the same order, since sounds are those of
+// whole keys.
+//
+// Arugments:
+// query (string): the base key, whose words are separated by whitespace
+// threshold (int): how far can a word of a key be from a word of the query
+// in the Levenshtein metric space
+// minRatio (float64): the minimum token set ratio of the results, between 0
+// and 1
+// maxResults (int): the maximum number of results which will be returned
+//
+// Returns: ([]Match) the keys found along with their values, with 1 minus
+// their token set ratio as their distance
+func (service Service) QueryTokens(query string, threshold int, minRatio float64, maxResults int) []Match {
+	query = service.normalize(query)
+	words := appendDistinctWords(nil, query)
+	if len(words) == 0 {
+		return []Match{}
+	}
+	distance := Levenshtein.distance(service.options.Costs)
+	h := new(keyScoreHeap)
+	heap.Init(h)
+	heapMutex := &sync.Mutex{}
+	var wait sync.WaitGroup
+
+	service.rwmutex.RLock()
+	for _, bucket := range service.dictionary {
+		wait.Add(1)
+		go func(bucket map[uint32][]storage, mutex *sync.Mutex) {
+			scorer := newTokenScorer(words, distance, float64(threshold))
+			for _, list := range bucket {
+				for _, pair := range list {
+					ratio, found := scorer.score(pair.key)
+					if found && ratio >= minRatio {
+						mutex.Lock()
+						heap.Push(h, keyScore{prefix(pair.key, query), 1 - ratio, pair.original, pair.values, true})
+						if h.Len() > maxResults {
+							heap.Pop(h)
+						}
+						mutex.Unlock()
+					}
+				}
+			}
+			scorer.release()
+			wait.Done()
+		}(bucket, heapMutex)
+	}
+	wait.Wait()
+	service.rwmutex.RUnlock()
+
+	sort.Sort(h)
+	results := make([]Match, h.Len())
+	for i := 0; i < len(results); i++ {
+		results[i] = service.match(h.Pop().(keyScore))
+	}
+	scorer := newTokenScorer(words, distance, unbounded)
+	defer scorer.release()
+	return service.withSounds(query, results, maxResults, func(_ *levenshtein.Matcher, key string) float64 {
+		ratio, _ := scorer.score(key)
+		return 1 - ratio
+	})
+}
@@ -0,0 +1,78 @@
+package fuzzy
+
+import (
+	"math"
+	"testing"
+)
+
+func TestServiceTokens(t *testing.T) {
+	service := NewServiceWithOptions(Options{Normalizer: Lowercase})
+	service.Set("palpitas crecelle seau", "1")
+	service.Set("seau", "2")
+	service.Set("crecelle rouge", "3")
+	service.Set("palpitas", "4")
+
+	/* The same words in another order are a perfect match */
+	result := service.QueryTokens("Seau palpitas crecelle", 0, 0.8, 5)
+	if len(result) != 1 || result[0].Key != "palpitas crecelle seau" || result[0].Distance != 0 {
+		t.Log(result)
+		t.Error("Token query should ignore the order of the words")
+	}
+	if result := service.QueryMetric("seau palpitas crecelle", Levenshtein, 2, 5); len(result) != 0 {
+		t.Error("Reordered words should be far apart in the Levenshtein distance")
+	}
+
+	/* Misspelled words are matched within the threshold */
+	result = service.QueryTokens("crecele palpita", 1, 0.5, 5)
+	if len(result) != 1 || result[0].Key != "palpitas crecelle seau" {
+		t.Log(result)
+		t.Error("Token query should match misspelled words")
+	}
+	// "crecele palpita" against "crecelle palpitas seau" is 7 edits over 22 runes
+	if ratio := 1 - result[0].Distance; math.Abs(ratio-15.0/22) > 1e-9 {
+		t.Error("Token set ratio should be 15/22, not", ratio)
+	}
+
+	/* Only the keys holding the same words are a perfect match */
+	result = service.QueryTokens("seau", 0, 1, 5)
+	if len(result) != 1 || result[0].Key != "seau" || result[0].Distance != 0 {
+		t.Log(result)
+		t.Error("Token set ratio should be 1 for keys holding the same words only")
+	}
+	if result := service.QueryTokens("seau", 0, 0, 1); len(result) != 1 {
+		t.Error("Token query should return at most the maximum number of results")
+	}
+
+	/* Words in excess on either side lower the ratio */
+	result = service.QueryTokens("seau palpitas", 0, 0, 5)
+	if len(result) != 3 || result[0].Key != "palpitas" || result[1].Key != "palpitas crecelle seau" ||
+		result[2].Key != "seau" || result[0].Distance == 0 || result[1].Distance == 0 {
+		t.Log(result)
+		t.Error("Keys missing words of the query or holding more should have a lower ratio")
+	}
+
+	/* The ratio bounds the words the query may have in excess */
+	if result := service.QueryTokens("crecelle bleue verte", 0, 0.9, 5); len(result) != 0 {
+		t.Log(result)
+		t.Error("Token query should leave out the keys below the minimum ratio")
+	}
+	if result := service.QueryTokens("  ", 1, 0, 5); len(result) != 0 {
+		t.Error("Query without words should not match anything")
+	}
+}
+
+func TestTokenSetRatioSymmetry(t *testing.T) {
+	service := NewService()
+	service.Set("a b", "1")
+	service.Set("a b c d e", "2")
+
+	// "a b" against "a b c d e" is 6 edits over 9 runes, whichever the query
+	for _, query := range []string{"a b", "a b c d e"} {
+		result := service.QueryTokens(query, 0, 0, 5)
+		if len(result) != 2 || result[0].Key != query || result[0].Distance != 0 ||
+			math.Abs(result[1].Distance-6.0/9) > 1e-9 {
+			t.Log(result)
+			t.Errorf("Token set ratio of %q should be 1 for itself and 3/9 for the other key", query)
+		}
+	}
+}
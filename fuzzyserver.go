@@ -2,44 +2,154 @@ package main
 
 import (
 	"./server"
-	"encoding/json"
+	"./wal"
+	"context"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"runtime"
+	"syscall"
+	"time"
 )
 
-type configuration struct {
-	Port string
+func saveOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1)
+	for range signals {
+		if err := server.Persist(); err != nil {
+			slog.Error("Could not save the snapshots", "error", err)
+		} else {
+			slog.Info("Saved the snapshots of all stores")
+		}
+	}
 }
 
-func loadConfiguration() *configuration {
-	// We always get our conf from conf.json
-	file, _ := os.Open("conf.json")
+// logRequests logs every request at the debug level
+func logRequests(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		handler.ServeHTTP(w, r)
+		slog.Debug("Handled a request", "method", r.Method, "path", r.URL.Path,
+			"remote", r.RemoteAddr, "duration", time.Since(start))
+	})
+}
 
-	decoder := json.NewDecoder(file)
-	conf := new(configuration)
-	err := decoder.Decode(&conf)
-	if err != nil {
-		fmt.Println("[FATAL ERROR]", err)
-		return nil
-	}
-	return conf
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "[FATAL ERROR]", err)
+	os.Exit(1)
 }
 
 func main() {
 
-	conf := loadConfiguration()
-	if conf == nil {
+	conf, err := loadConfiguration(os.Args[1:], os.Getenv)
+	if err == flag.ErrHelp {
 		return
 	}
+	if err != nil {
+		fatal(err)
+	}
+	level, _ := conf.logLevel()
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+	server.SetLimits(server.Limits{
+		MaxRequestSize: conf.MaxRequestSize,
+		DefaultResults: conf.DefaultResults,
+		MaxResults:     conf.MaxResults,
+		MaxDistance:    conf.MaxDistance,
+	})
+	// Clients authenticate with API keys once some are configured
+	if len(conf.APIKeys) != 0 {
+		if err := server.LoadAPIKeys(conf.APIKeys); err != nil {
+			fatal(err)
+		}
+		if len(conf.TLSCert) == 0 {
+			slog.Warn("API keys are sent in clear text since TLS is not enabled")
+		}
+	}
 	// We set the maximum number of cores to be used
 	runtime.GOMAXPROCS(runtime.NumCPU())
 
+	// Stores are loaded from their snapshots, which are saved on SIGUSR1
+	if len(conf.DataDir) != 0 {
+		if err := server.Restore(conf.DataDir); err != nil {
+			fatal(err)
+		}
+		// Mutations between snapshots are kept in write-ahead logs
+		if len(conf.WAL) != 0 {
+			policy, err := wal.ParseSyncPolicy(conf.WAL)
+			if err == nil {
+				err = server.EnableJournals(policy)
+			}
+			if err != nil {
+				fatal(err)
+			}
+		}
+		go saveOnSignal()
+	}
+
 	// API Handlers
+	http.HandleFunc("/v1/", server.V1Handler)
+	// Legacy API Handlers
 	http.HandleFunc("/fuzzy", server.FuzzyHandler)
 	http.HandleFunc("/fuzzy/batch", server.BatchHandler)
+	http.HandleFunc("/fuzzy/complete", server.CompleteHandler)
+	http.HandleFunc("/fuzzy/stats", server.StatsHandler)
+	http.HandleFunc("/fuzzy/snapshot", server.SnapshotHandler)
 
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%s", conf.Port), nil))
+	httpServer := &http.Server{
+		Addr:         net.JoinHostPort(conf.Address, conf.Port),
+		Handler:      logRequests(http.MaxBytesHandler(http.DefaultServeMux, conf.MaxRequestSize)),
+		ReadTimeout:  time.Duration(conf.ReadTimeout),
+		WriteTimeout: time.Duration(conf.WriteTimeout),
+		IdleTimeout:  time.Duration(conf.IdleTimeout),
+	}
+	if len(conf.TLSCert) != 0 {
+		if httpServer.TLSConfig, err = server.NewTLSConfig(conf.TLSCert, conf.TLSKey, conf.TLSClientCA); err != nil {
+			fatal(err)
+		}
+	}
+	serverErrors := make(chan error, 1)
+	go func() {
+		if httpServer.TLSConfig != nil {
+			/* The certificate is served by the TLS configuration, which
+			   reloads it when it is rotated */
+			serverErrors <- httpServer.ListenAndServeTLS("", "")
+		} else {
+			serverErrors <- httpServer.ListenAndServe()
+		}
+	}()
+	slog.Info("Listening", "address", httpServer.Addr, "tls", httpServer.TLSConfig != nil, "client_certificates", len(conf.TLSClientCA) != 0)
+
+	// SIGTERM and SIGINT stop the server gracefully
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	select {
+	case err := <-serverErrors:
+		fatal(err)
+	case received := <-signals:
+		slog.Info("Shutting down", "signal", received)
+	}
+	shutdown(httpServer, time.Duration(conf.ShutdownTimeout), len(conf.DataDir) != 0)
+}
+
+// shutdown stops accepting connections, waits for the in-flight requests to
+// finish and then saves the stores, if they are persisted. Requests still
+// running after the timeout can no longer change the saved stores.
+func shutdown(httpServer *http.Server, timeout time.Duration, persist bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := httpServer.Shutdown(ctx); err != nil {
+		slog.Error("Could not drain the in-flight requests", "error", err)
+	}
+
+	if persist {
+		if err := server.Close(); err != nil {
+			slog.Error("Could not save the stores", "error", err)
+			return
+		}
+		slog.Info("Saved the snapshots of all stores")
+	}
 }
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"./fuzzy"
+	"./server"
+	"./wal"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestShutdownTimeout(t *testing.T) {
+	dir := t.TempDir()
+	if err := server.Restore(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.EnableJournals(wal.SyncPolicy{Mode: wal.SyncAlways}); err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	server.FuzzyHandler(recorder, httptest.NewRequest("POST", "/fuzzy?store=shutdown", nil))
+	if recorder.Code != http.StatusCreated {
+		t.Fatal("Could not create the store:", recorder.Body.String())
+	}
+
+	/* A request outliving the shutdown timeout sets a key once the stores
+	   have been saved */
+	started, release, status := make(chan bool), make(chan bool), make(chan int, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		started <- true
+		<-release
+		recorder := httptest.NewRecorder()
+		server.FuzzyHandler(recorder, httptest.NewRequest("PUT", "/fuzzy?store=shutdown&key=late&value=1", nil))
+		status <- recorder.Code
+	})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpServer := &http.Server{Handler: mux}
+	go httpServer.Serve(listener)
+	defer httpServer.Close()
+	go http.Get("http://" + listener.Addr().String() + "/slow")
+	<-started
+
+	shutdown(httpServer, 10*time.Millisecond, true)
+	close(release)
+	if code := <-status; code == http.StatusOK {
+		t.Error("Setting a key after the stores were saved should fail")
+	}
+	store, err := fuzzy.LoadSnapshot(filepath.Join(dir, "shutdown.snapshot"), fuzzy.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, present := store.Get("late"); present {
+		t.Error("Key set after the stores were saved should not be in the snapshot")
+	}
+}
@@ -0,0 +1,307 @@
+package levenshtein
+
+import (
+	"math"
+	"unicode"
+)
+
+// CostModel tells how much every kind of edit costs when computing a
+// weighted edit distance. Costs should be strictly positive: with free edits
+// the number of edits within a threshold is unbounded, so the distance and
+// the queries using it fall back to comparing every string.
+type CostModel interface {
+	Insert(r rune) float64
+	Delete(r rune) float64
+	Substitute(source, target rune) float64
+	Transpose(first, second rune) float64
+	// MinCost returns a lower bound for the cost of any single edit. It
+	// turns the number of edits counted by the histogram filters and the
+	// length buckets into a lower bound for the weighted distance.
+	MinCost() float64
+}
+
+// UnitCosts is the CostModel of the plain Levenshtein distance, where every
+// edit costs exactly 1.
+type UnitCosts struct{}
+
+// Insert costs 1 for every rune
+func (UnitCosts) Insert(r rune) float64 { return 1 }
+
+// Delete costs 1 for every rune
+func (UnitCosts) Delete(r rune) float64 { return 1 }
+
+// Substitute costs 1 for every pair of runes
+func (UnitCosts) Substitute(source, target rune) float64 { return 1 }
+
+// Transpose costs 1 for every pair of runes
+func (UnitCosts) Transpose(first, second rune) float64 { return 1 }
+
+// MinCost is 1 since every edit costs 1
+func (UnitCosts) MinCost() float64 { return 1 }
+
+// Keyboard layouts, given as rows of keys from top to bottom. Every row is
+// shifted to the right by about half a key compared to the one above it.
+var (
+	QWERTY = []string{"1234567890-=", "qwertyuiop[]", "asdfghjkl;'", "zxcvbnm,./"}
+	AZERTY = []string{"&é\"'(-è_çà)=", "azertyuiop^$", "qsdfghjklmù*", "<wxcvbn,;:!"}
+)
+
+// KeyboardCosts is a CostModel for typing mistakes: substituting a rune with
+// one on a neighbouring key of the keyboard costs Adjacent instead of
+// Substitution. Letters are compared regardless of case.
+type KeyboardCosts struct {
+	Insertion     float64
+	Deletion      float64
+	Substitution  float64
+	Adjacent      float64
+	Transposition float64
+	neighbours    map[rune][]rune
+}
+
+// NewKeyboardCosts creates a KeyboardCosts for a keyboard layout, such as
+// QWERTY or AZERTY. Every edit costs 1, except for substitutions between
+// neighbouring keys which cost adjacent. The costs may be tuned afterwards
+// through the exported fields.
+//
+// Arguments:
+// layout ([]string): the rows of keys of the keyboard, from top to bottom
+// adjacent (float64): the cost of substituting neighbouring keys
+//
+// Returns: (*KeyboardCosts) the cost model
+func NewKeyboardCosts(layout []string, adjacent float64) *KeyboardCosts {
+	rows := make([][]rune, len(layout))
+	for i, row := range layout {
+		rows[i] = []rune(row)
+	}
+	key := func(row, column int) (rune, bool) {
+		if row < 0 || row >= len(rows) || column < 0 || column >= len(rows[row]) {
+			return 0, false
+		}
+		return rows[row][column], true
+	}
+
+	neighbours := make(map[rune][]rune)
+	for i, row := range rows {
+		for j, r := range row {
+			// Because of the shift between rows, the keys touching (i, j) on
+			// the row above are j and j+1, and on the row below j-1 and j
+			candidates := [][2]int{{i, j - 1}, {i, j + 1}, {i - 1, j}, {i - 1, j + 1}, {i + 1, j - 1}, {i + 1, j}}
+			for _, candidate := range candidates {
+				if neighbour, present := key(candidate[0], candidate[1]); present {
+					neighbours[r] = append(neighbours[r], neighbour)
+				}
+			}
+		}
+	}
+	return &KeyboardCosts{1, 1, 1, adjacent, 1, neighbours}
+}
+
+// Insert costs Insertion for every rune
+func (costs *KeyboardCosts) Insert(r rune) float64 { return costs.Insertion }
+
+// Delete costs Deletion for every rune
+func (costs *KeyboardCosts) Delete(r rune) float64 { return costs.Deletion }
+
+// Transpose costs Transposition for every pair of runes
+func (costs *KeyboardCosts) Transpose(first, second rune) float64 { return costs.Transposition }
+
+// Substitute costs Adjacent for neighbouring keys and Substitution otherwise
+func (costs *KeyboardCosts) Substitute(source, target rune) float64 {
+	source, target = unicode.ToLower(source), unicode.ToLower(target)
+	// Getting the case wrong is as close as hitting a neighbouring key
+	if source == target {
+		return costs.Adjacent
+	}
+	for _, neighbour := range costs.neighbours[source] {
+		if neighbour == target {
+			return costs.Adjacent
+		}
+	}
+	return costs.Substitution
+}
+
+// MinCost is the smallest of the configured costs
+func (costs *KeyboardCosts) MinCost() float64 {
+	return math.Min(math.Min(costs.Insertion, costs.Deletion),
+		math.Min(math.Min(costs.Substitution, costs.Adjacent), costs.Transposition))
+}
+
+// costEpsilon absorbs the rounding errors of adding fractional costs
+const costEpsilon = 1e-9
+
+// MaxEdits returns the largest number of edits which can fit within a
+// threshold of the weighted distance, given that no edit costs less than
+// MinCost. Filters counting edits can compare their bounds against it.
+//
+// Arguments:
+// threshold (float64): the threshold of the weighted distance
+// costs (CostModel): the cost of every edit
+//
+// Returns: (int) the maximum number of edits, or -1 if MinCost is not positive
+func MaxEdits(threshold float64, costs CostModel) int {
+	minCost := costs.MinCost()
+	if minCost <= 0 {
+		return -1
+	}
+	return int((threshold + costEpsilon) / minCost)
+}
+
+// WeightedDistanceThreshold computes the Levenshtein distance between two
+// strings where every edit is weighted by a cost model, if and only if it is
+// smaller than a specific threshold.
+//
+// Arugments:
+// source, target (string): the two strings to compute the distance for
+// threshold (float64): the threshold of the weighted distance
+// costs (CostModel): the cost of every edit
+//
+// Returns: (float64, bool) the weighted distance and if it is lower than the
+// threshold. The first value is valid iff the second one is true.
+func WeightedDistanceThreshold(source, target string, threshold float64, costs CostModel) (float64, bool) {
+	return weightedThreshold([]rune(source), []rune(target), threshold, costs, false, new(buffers))
+}
+
+// WeightedDamerauThreshold works just like WeightedDistanceThreshold, but
+// computes the Optimal String Alignment distance, where adjacent runes may
+// also be transposed.
+func WeightedDamerauThreshold(source, target string, threshold float64, costs CostModel) (float64, bool) {
+	return weightedThreshold([]rune(source), []rune(target), threshold, costs, true, new(buffers))
+}
+
+// weightedThreshold runs the same banded computation as
+// bandedDistanceThreshold. Since every edit costs at least MinCost, a
+// distance within the threshold can use at most threshold / MinCost edits,
+// which gives the band width. The costs may not be symmetric, so the strings
+// are never swapped.
+func weightedThreshold(source, target []rune, threshold float64, costs CostModel, transpositions bool, rows *buffers) (float64, bool) {
+	sourceLen, targetLen := len(source), len(target)
+	diff := targetLen - sourceLen
+
+	edits := sourceLen + targetLen
+	if maxEdits := MaxEdits(threshold, costs); maxEdits >= 0 {
+		edits = min(edits, maxEdits)
+	}
+	if abs(diff) > edits {
+		return -1, false
+	}
+
+	infinity := math.Inf(1)
+	v2, v0, v1 := rows.floats(targetLen + 1)
+	band := func(i int) (int, int) {
+		return max(0, max(i-edits, i+diff-edits)), min(targetLen, min(i+edits, i+diff+edits))
+	}
+
+	// Every row is surrounded by infinite cells, so that reading the cells
+	// just outside of its band while computing the next row is safe
+	start, stop := band(0)
+	v0[0] = 0
+	for j := 1; j <= stop; j++ {
+		v0[j] = v0[j-1] + costs.Insert(target[j-1])
+	}
+	if stop < targetLen {
+		v0[stop+1] = infinity
+	}
+
+	previousStart, previousStop := start, stop
+	lower, previousLower := 0.0, 0.0 // Lower bounds of the last two rows, row 0 starting at 0
+	for i := 1; i <= sourceLen; i++ {
+		start, stop = band(i)
+		if start > 0 {
+			v1[start-1] = infinity
+		}
+		if stop < targetLen {
+			v1[stop+1] = infinity
+		}
+		lower = infinity
+		for j := start; j <= stop; j++ {
+			if j == 0 {
+				v1[j] = v0[j] + costs.Delete(source[i-1])
+			} else {
+				substitution := 0.0
+				if source[i-1] != target[j-1] {
+					substitution = costs.Substitute(source[i-1], target[j-1])
+				}
+				v1[j] = math.Min(math.Min(v1[j-1]+costs.Insert(target[j-1]), v0[j]+costs.Delete(source[i-1])),
+					v0[j-1]+substitution)
+				if transpositions && i > 1 && j > 1 && j-2 >= previousStart && j-2 <= previousStop &&
+					source[i-1] == target[j-2] && source[i-2] == target[j-1] && source[i-1] != source[i-2] {
+					v1[j] = math.Min(v1[j], v2[j-2]+costs.Transpose(source[i-2], source[i-1]))
+				}
+			}
+			lower = math.Min(lower, v1[j])
+		}
+		// A transposition skips a row, so with transpositions we can only
+		// stop once two consecutive rows are beyond the threshold
+		if lower > threshold+costEpsilon && (!transpositions || previousLower > threshold+costEpsilon) {
+			return -1, false
+		}
+		previousLower = lower
+		previousStart, previousStop = band(i - 1)
+		v2, v0, v1 = v0, v1, v2
+	}
+
+	distance := v0[targetLen]
+	if distance > threshold+costEpsilon {
+		return -1, false
+	}
+	return distance, true
+}
+
+// WeightedPrefixDistanceThreshold works just like PrefixDistanceThreshold,
+// but every edit is weighted by a cost model: it computes the smallest
+// weighted distance between a prefix and the beginnings of a target string.
+//
+// Arugments:
+// prefix (string): the typed text
+// target (string): the string which may complete it
+// threshold (float64): the threshold of the weighted distance
+// costs (CostModel): the cost of every edit
+//
+// Returns: (float64, bool) the weighted distance and if it is lower than the
+// threshold. The first value is valid iff the second one is true.
+func WeightedPrefixDistanceThreshold(prefix, target string, threshold float64, costs CostModel) (float64, bool) {
+	return weightedPrefixThreshold([]rune(prefix), []rune(target), threshold, costs, new(buffers))
+}
+
+// weightedPrefixThreshold computes every row of the weighted distances from
+// the prefix to the beginnings of the target, the smallest cell of the last
+// row being the distance to the closest beginning. Beginnings longer than the
+// prefix by more edits than the threshold allows are left out.
+func weightedPrefixThreshold(prefix, target []rune, threshold float64, costs CostModel, rows *buffers) (float64, bool) {
+	prefixLen, targetLen := len(prefix), len(target)
+	if maxEdits := MaxEdits(threshold, costs); maxEdits >= 0 {
+		targetLen = min(targetLen, prefixLen+maxEdits)
+	}
+
+	v0, v1, _ := rows.floats(targetLen + 1)
+	v0[0] = 0
+	for j := 1; j <= targetLen; j++ {
+		v0[j] = v0[j-1] + costs.Insert(target[j-1])
+	}
+	for i := 1; i <= prefixLen; i++ {
+		v1[0] = v0[0] + costs.Delete(prefix[i-1])
+		lower := v1[0]
+		for j := 1; j <= targetLen; j++ {
+			substitution := 0.0
+			if prefix[i-1] != target[j-1] {
+				substitution = costs.Substitute(prefix[i-1], target[j-1])
+			}
+			v1[j] = math.Min(math.Min(v1[j-1]+costs.Insert(target[j-1]), v0[j]+costs.Delete(prefix[i-1])),
+				v0[j-1]+substitution)
+			lower = math.Min(lower, v1[j])
+		}
+		if lower > threshold+costEpsilon {
+			return -1, false
+		}
+		v0, v1 = v1, v0
+	}
+
+	distance := v0[0]
+	for _, cell := range v0[1 : targetLen+1] {
+		distance = math.Min(distance, cell)
+	}
+	if distance > threshold+costEpsilon {
+		return -1, false
+	}
+	return distance, true
+}
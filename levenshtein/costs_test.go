@@ -0,0 +1,190 @@
+package levenshtein
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// randomCosts is a CostModel with random, asymmetric and fractional costs
+type randomCosts struct {
+	insert, delete, transpose map[rune]float64
+	substitute                map[[2]rune]float64
+	minCost                   float64
+}
+
+func newRandomCosts(r *rand.Rand, alphabet []rune) *randomCosts {
+	costs := &randomCosts{map[rune]float64{}, map[rune]float64{}, map[rune]float64{},
+		map[[2]rune]float64{}, math.Inf(1)}
+	cost := func() float64 {
+		c := 0.25 + float64(r.Intn(8))*0.25
+		costs.minCost = math.Min(costs.minCost, c)
+		return c
+	}
+	for _, a := range alphabet {
+		costs.insert[a], costs.delete[a], costs.transpose[a] = cost(), cost(), cost()
+		for _, b := range alphabet {
+			costs.substitute[[2]rune{a, b}] = cost()
+		}
+	}
+	return costs
+}
+
+func (c *randomCosts) Insert(r rune) float64 { return c.insert[r] }
+func (c *randomCosts) Delete(r rune) float64 { return c.delete[r] }
+func (c *randomCosts) Substitute(source, target rune) float64 {
+	return c.substitute[[2]rune{source, target}]
+}
+func (c *randomCosts) Transpose(first, second rune) float64 { return c.transpose[first] }
+func (c *randomCosts) MinCost() float64                     { return c.minCost }
+
+// referenceWeighted computes the weighted distance using the full matrix
+func referenceWeighted(source, target []rune, costs CostModel, transpositions bool) float64 {
+	m := make([][]float64, len(source)+1)
+	for i := range m {
+		m[i] = make([]float64, len(target)+1)
+		if i > 0 {
+			m[i][0] = m[i-1][0] + costs.Delete(source[i-1])
+		}
+	}
+	for j := 1; j <= len(target); j++ {
+		m[0][j] = m[0][j-1] + costs.Insert(target[j-1])
+	}
+	for i := 1; i <= len(source); i++ {
+		for j := 1; j <= len(target); j++ {
+			substitution := 0.0
+			if source[i-1] != target[j-1] {
+				substitution = costs.Substitute(source[i-1], target[j-1])
+			}
+			m[i][j] = math.Min(math.Min(m[i-1][j]+costs.Delete(source[i-1]), m[i][j-1]+costs.Insert(target[j-1])),
+				m[i-1][j-1]+substitution)
+			if transpositions && i > 1 && j > 1 && source[i-1] == target[j-2] && source[i-2] == target[j-1] &&
+				source[i-1] != source[i-2] {
+				m[i][j] = math.Min(m[i][j], m[i-2][j-2]+costs.Transpose(source[i-2], source[i-1]))
+			}
+		}
+	}
+	return m[len(source)][len(target)]
+}
+
+func TestWeightedUnitCosts(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	alphabet := []rune("abcé")
+	for n := 0; n < 20000; n++ {
+		source, target := randomRunes(r, alphabet, 8), randomRunes(r, alphabet, 8)
+		threshold := r.Intn(5)
+		distance, within := DistanceThreshold(string(source), string(target), threshold)
+		weighted, weightedWithin := WeightedDistanceThreshold(string(source), string(target), float64(threshold), UnitCosts{})
+		if within != weightedWithin || (within && float64(distance) != weighted) {
+			t.Log(string(source), string(target), threshold, distance, weighted)
+			t.Fatal("Unit costs should give the Levenshtein distance")
+		}
+		distance, within = DamerauThreshold(string(source), string(target), threshold)
+		weighted, weightedWithin = WeightedDamerauThreshold(string(source), string(target), float64(threshold), UnitCosts{})
+		if within != weightedWithin || (within && float64(distance) != weighted) {
+			t.Log(string(source), string(target), threshold, distance, weighted)
+			t.Fatal("Unit costs should give the Damerau distance")
+		}
+	}
+}
+
+func TestWeightedPrefixUnitCosts(t *testing.T) {
+	r := rand.New(rand.NewSource(7))
+	alphabet := []rune("abcé")
+	for n := 0; n < 20000; n++ {
+		prefix, target := randomRunes(r, alphabet, 5), randomRunes(r, alphabet, 8)
+		threshold := r.Intn(4)
+		distance, within := PrefixDistanceThreshold(string(prefix), string(target), threshold)
+		weighted, weightedWithin := WeightedPrefixDistanceThreshold(string(prefix), string(target), float64(threshold), UnitCosts{})
+		if within != weightedWithin || (within && float64(distance) != weighted) {
+			t.Log(string(prefix), string(target), threshold, distance, weighted)
+			t.Fatal("Unit costs should give the prefix distance")
+		}
+	}
+
+	qwerty := NewKeyboardCosts(QWERTY, 0.5)
+	if distance, within := WeightedPrefixDistanceThreshold("fyzz", "fuzzyguy", 1, qwerty); !within || distance != 0.5 {
+		t.Error("Prefix distance of a neighbouring key should be 0.5, not", distance, within)
+	}
+}
+
+func TestWeightedReference(t *testing.T) {
+	r := rand.New(rand.NewSource(5))
+	alphabet := []rune("abcé")
+	for n := 0; n < 20000; n++ {
+		costs := newRandomCosts(r, alphabet)
+		source, target := randomRunes(r, alphabet, 7), randomRunes(r, alphabet, 7)
+		threshold := float64(r.Intn(12)) * 0.25
+		for _, transpositions := range []bool{false, true} {
+			expected := referenceWeighted(source, target, costs, transpositions)
+			distance, within := weightedThreshold(source, target, threshold, costs, transpositions, new(buffers))
+			if within != (expected <= threshold+costEpsilon) || (within && math.Abs(distance-expected) > costEpsilon) {
+				t.Log(string(source), string(target), threshold, transpositions, expected, distance, within)
+				t.Fatal("Banded weighted distance differs from the full matrix")
+			}
+		}
+	}
+}
+
+func TestWeightedCheapTransposition(t *testing.T) {
+	/* Every cell of the first row is beyond the threshold, but the
+	   transposition reaches the last row from row 0 */
+	costs := NewKeyboardCosts(QWERTY, 1)
+	costs.Transposition = 0.1
+	distance, within := WeightedDamerauThreshold("ab", "ba", 0.5, costs)
+	if !within || math.Abs(distance-0.1) > costEpsilon {
+		t.Error("Transposition of two runes should cost 0.1, not", distance, within)
+	}
+}
+
+func TestKeyboardCosts(t *testing.T) {
+	qwerty := NewKeyboardCosts(QWERTY, 0.5)
+	var testCases = []struct {
+		source   string
+		target   string
+		distance float64
+	}{
+		{"quick", "qiick", 0.5},
+		{"quick", "qoick", 1},
+		{"sad", "sax", 0.5},
+		{"sad", "spd", 1},
+		{"Sad", "sad", 0.5},
+		{"hello", "hell", 1},
+	}
+	for _, testCase := range testCases {
+		distance, within := WeightedDistanceThreshold(testCase.source, testCase.target, 2, qwerty)
+		if !within || math.Abs(distance-testCase.distance) > costEpsilon {
+			t.Log(testCase.source, testCase.target, "computed as", distance, ", should be", testCase.distance)
+			t.Error("Failed to compute the QWERTY distance")
+		}
+	}
+
+	azerty := NewKeyboardCosts(AZERTY, 0.5)
+	if azerty.Substitute('a', 'z') != 0.5 || azerty.Substitute('a', 'q') != 0.5 || azerty.Substitute('a', 'p') != 1 {
+		t.Error("Failed to find the AZERTY neighbours")
+	}
+	if qwerty.Substitute('a', 'q') != 0.5 || qwerty.Substitute('a', 'z') != 0.5 || qwerty.Substitute('a', 'x') != 1 {
+		t.Error("Failed to find the QWERTY neighbours")
+	}
+
+	/* Insertions and deletions can be tuned independently */
+	qwerty.Insertion, qwerty.Deletion = 2, 0.75
+	if distance, _ := WeightedDistanceThreshold("hello", "hell", 2, qwerty); distance != 0.75 {
+		t.Error("Failed to apply the deletion cost")
+	}
+	if distance, _ := WeightedDistanceThreshold("hell", "hello", 2, qwerty); distance != 2 {
+		t.Error("Failed to apply the insertion cost")
+	}
+	if qwerty.MinCost() != 0.5 {
+		t.Error("Failed to compute the minimum cost")
+	}
+}
+
+func BenchmarkWeightedDistanceThreshold(b *testing.B) {
+	source := "informatcia supre"
+	target := "informatica super"
+	costs := NewKeyboardCosts(QWERTY, 0.5)
+	for n := 0; n < b.N; n++ {
+		WeightedDistanceThreshold(source, target, 3, costs)
+	}
+}
@@ -0,0 +1,126 @@
+package levenshtein
+
+// winklerPrefix is the longest common prefix rewarded by the Winkler boost,
+// and winklerScale the reward of every rune of it
+const (
+	winklerPrefix = 4
+	winklerScale  = 0.1
+)
+
+// JaroWinkler computes the Jaro-Winkler similarity between two strings, from
+// 0 for strings with nothing in common to 1 for equal strings. Runes match
+// when they are equal and close to the same position in both strings, and
+// strings sharing their first runes get a boost, which makes it well suited
+// to short strings such as names.
+//
+// Arguments:
+// source, target (string): the two strings to compute the similarity for
+//
+// Returns: (float64) the Jaro-Winkler similarity
+func JaroWinkler(source, target string) float64 {
+	similarity, _ := jaroWinklerThreshold([]rune(source), []rune(target), 0, new(buffers))
+	return similarity
+}
+
+// JaroWinklerThreshold computes the Jaro-Winkler similarity between two
+// strings if and only if it is at least a minimum similarity. Strings which
+// can not reach it are given up on before counting their transpositions.
+//
+// Arguments:
+// source, target (string): the two strings to compute the similarity for
+// minSimilarity (float64): the minimum similarity, between 0 and 1
+//
+// Returns: (float64, bool) the similarity and if it is at least the minimum
+// one. The first value is valid iff the second one is true.
+func JaroWinklerThreshold(source, target string, minSimilarity float64) (float64, bool) {
+	return jaroWinklerThreshold([]rune(source), []rune(target), minSimilarity, new(buffers))
+}
+
+// MaxJaroWinkler computes the highest Jaro-Winkler similarity two strings of
+// the given lengths in runes may have, which lets queries skip every key of a
+// length that can not be similar enough.
+//
+// Arguments:
+// sourceLen, targetLen (int): the lengths of the two strings
+//
+// Returns: (float64) the upper bound of their similarity
+func MaxJaroWinkler(sourceLen, targetLen int) float64 {
+	shorter := min(sourceLen, targetLen)
+	if shorter == 0 {
+		if sourceLen == targetLen {
+			return 1
+		}
+		return 0
+	}
+	// Every rune of the shorter string matches, without transpositions
+	return boundJaroWinkler(shorter, sourceLen, targetLen, min(shorter, winklerPrefix))
+}
+
+// boundJaroWinkler is the similarity of strings with the given number of
+// matching runes, common prefix and no transpositions, which is the highest
+// one they may have
+func boundJaroWinkler(matches, sourceLen, targetLen, prefix int) float64 {
+	m := float64(matches)
+	jaro := (m/float64(sourceLen) + m/float64(targetLen) + 1) / 3
+	return winkler(jaro, prefix)
+}
+
+func winkler(jaro float64, prefix int) float64 {
+	return jaro + float64(prefix)*winklerScale*(1-jaro)
+}
+
+func jaroWinklerThreshold(source, target []rune, minSimilarity float64, rows *buffers) (float64, bool) {
+	sourceLen, targetLen := len(source), len(target)
+	if sourceLen == 0 || targetLen == 0 {
+		similarity := MaxJaroWinkler(sourceLen, targetLen)
+		return similarity, similarity >= minSimilarity
+	}
+	if MaxJaroWinkler(sourceLen, targetLen) < minSimilarity {
+		return 0, false
+	}
+
+	prefix := 0
+	for prefix < min(winklerPrefix, min(sourceLen, targetLen)) && source[prefix] == target[prefix] {
+		prefix++
+	}
+
+	// Runes match when they are no further apart than the window
+	window := max(0, max(sourceLen, targetLen)/2-1)
+	sourceMatched, targetMatched := rows.flags(sourceLen, targetLen)
+	matches := 0
+	for i, r := range source {
+		for j := max(0, i-window); j < min(targetLen, i+window+1); j++ {
+			if !targetMatched[j] && target[j] == r {
+				sourceMatched[i], targetMatched[j] = true, true
+				matches++
+				break
+			}
+		}
+	}
+	if matches == 0 || boundJaroWinkler(matches, sourceLen, targetLen, prefix) < minSimilarity {
+		return 0, false
+	}
+
+	// Matching runes which are not in the same order are transposed
+	transpositions, j := 0, 0
+	for i, r := range source {
+		if !sourceMatched[i] {
+			continue
+		}
+		for !targetMatched[j] {
+			j++
+		}
+		if target[j] != r {
+			transpositions++
+		}
+		j++
+	}
+
+	m := float64(matches)
+	jaro := (m/float64(sourceLen) + m/float64(targetLen) + (m-float64(transpositions/2))/m) / 3
+	similarity := winkler(jaro, prefix)
+	if similarity < minSimilarity {
+		return 0, false
+	}
+	return similarity, true
+}
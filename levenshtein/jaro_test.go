@@ -0,0 +1,60 @@
+package levenshtein
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestJaroWinkler(t *testing.T) {
+	var testCases = []struct {
+		source     string
+		target     string
+		similarity float64
+	}{
+		{"MARTHA", "MARHTA", 0.9611},
+		{"DWAYNE", "DUANE", 0.84},
+		{"DIXON", "DICKSONX", 0.8133},
+		{"CRATE", "TRACE", 0.7333},
+		{"JONES", "JOHNSON", 0.8324},
+		{"abc", "xyz", 0},
+		{"", "", 1},
+		{"a", "", 0},
+		{"café", "cafe", 0.8833},
+		{"same", "same", 1},
+	}
+	for _, testCase := range testCases {
+		similarity := JaroWinkler(testCase.source, testCase.target)
+		if math.Abs(similarity-testCase.similarity) > 0.0001 {
+			t.Error("Jaro-Winkler similarity between", testCase.source, "and", testCase.target,
+				"computed as", similarity, ", should be", testCase.similarity)
+		}
+	}
+}
+
+func TestJaroWinklerThreshold(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	alphabet := []rune("abcdé")
+	for n := 0; n < 20000; n++ {
+		source, target := string(randomRunes(r, alphabet, 10)), string(randomRunes(r, alphabet, 10))
+		minSimilarity := r.Float64()
+		expected := JaroWinkler(source, target)
+		if bound := MaxJaroWinkler(len([]rune(source)), len([]rune(target))); bound < expected {
+			t.Fatal("Similarity between", source, "and", target, "is", expected, "above its bound", bound)
+		}
+		similarity, within := JaroWinklerThreshold(source, target, minSimilarity)
+		if within != (expected >= minSimilarity) || (within && similarity != expected) {
+			t.Fatal("Similarity between", source, "and", target, "with cutoff", minSimilarity,
+				"computed as", similarity, ", should be", expected)
+		}
+	}
+}
+
+func BenchmarkJaroWinklerThreshold(b *testing.B) {
+	matcher := NewMatcher("informatcia supre")
+	target := "informatica super"
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		matcher.JaroWinklerThreshold(target, 0.8)
+	}
+}
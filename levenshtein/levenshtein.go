@@ -43,7 +43,8 @@ func abs(x int) int {
 }
 
 // DistanceThreshold computes the Levenshtein distance between two strings
-// if and only if it is smaller than a specific threshold
+// if and only if it is smaller than a specific threshold. The distance is
+// computed over runes, so multi-byte characters count as a single edit.
 //
 // Arugments:
 // source, target (string): thw two strings to compute the distance for
@@ -52,6 +53,49 @@ func abs(x int) int {
 // Returns: (int, bool) Levenshtein distance and if it is lower than the
 // threshold. The first value is valid iff the second one is true.
 func DistanceThreshold(source, target string, threshold int) (int, bool) {
+	return distanceThreshold([]rune(source), []rune(target), threshold)
+}
+
+func distanceThreshold(source, target []rune, threshold int) (int, bool) {
+	if len(source) > len(target) {
+		source, target = target, source
+	}
+	if distance, within, settled := trivialDistance(source, target, threshold); settled {
+		return distance, within
+	}
+	var pattern bitPattern
+	pattern.reset(source)
+	return pattern.distanceThreshold(target, threshold)
+}
+
+// trivialDistance settles the distances which need no computation: the ones
+// beyond the threshold because of the length difference alone, the ones
+// within a threshold of 0 and the ones to an empty string. The last value
+// tells whether the distance was settled.
+func trivialDistance(source, target []rune, threshold int) (int, bool, bool) {
+	// The length difference alone is a lower bound for the distance
+	if abs(len(target)-len(source)) > threshold {
+		return -1, false, true
+	}
+	if threshold <= 0 {
+		for i := range source {
+			if source[i] != target[i] {
+				return -1, false, true
+			}
+		}
+		return 0, true, true
+	}
+	if len(source) == 0 || len(target) == 0 {
+		return len(source) + len(target), true, true
+	}
+	return 0, false, false
+}
+
+// bandedDistanceThreshold computes the same distance as distanceThreshold
+// with the dynamic programming matrix, restricted to the band of cells which
+// may lead to a distance within the threshold. It is kept as the reference
+// of the bit-parallel computation.
+func bandedDistanceThreshold(source, target []rune, threshold int) (int, bool) {
 	sourceLen := len(source)
 	targetLen := len(target)
 
@@ -61,6 +105,18 @@ func DistanceThreshold(source, target string, threshold int) (int, bool) {
 	}
 
 	diff := targetLen - sourceLen
+	// The length difference alone is a lower bound for the distance
+	if diff > threshold {
+		return -1, false
+	}
+	if threshold <= 0 {
+		for i := range source {
+			if source[i] != target[i] {
+				return -1, false
+			}
+		}
+		return 0, true
+	}
 
 	v0, v1 := make([]int, targetLen+1), make([]int, targetLen+1)
 
@@ -68,11 +124,17 @@ func DistanceThreshold(source, target string, threshold int) (int, bool) {
 		v0[i] = i
 	}
 
+	// Cells outside of the band can not lead to a distance within the
+	// threshold, so we treat them as being infinitely far away
+	infinity := threshold + 1
 	cost, lower := 0, 0 // Lower bound at each step
-	for i := 0; i < sourceLen; i++ {
+	for i := 1; i <= sourceLen; i++ {
 		start, stop := max(0, i-threshold), min(targetLen, i+diff+threshold)
+		if previous := min(targetLen, i-1+diff+threshold); previous < targetLen {
+			v0[previous+1] = infinity
+		}
 		if start == 0 {
-			v1[start] = i + 1
+			v1[start] = i
 		} else {
 			cost = 0
 			if source[i-1] != target[start-1] {
@@ -81,20 +143,80 @@ func DistanceThreshold(source, target string, threshold int) (int, bool) {
 			v1[start] = min(v0[start]+1, v0[start-1]+cost)
 		}
 		lower = v1[start]
-		for j := start; j < stop-1; j++ {
+		for j := start + 1; j <= stop; j++ {
+			cost = 0
+			if source[i-1] != target[j-1] {
+				cost = 1
+			}
+			v1[j] = min3(v1[j-1]+1, v0[j]+1, v0[j-1]+cost)
+			lower = min(v1[j], lower)
+		}
+		// If the lower bound is higher than the threshold we return false
+		if lower > threshold {
+			return -1, false
+		}
+		v0, v1 = v1, v0
+	}
+
+	return v0[targetLen], v0[targetLen] <= threshold
+
+}
+
+// PrefixDistanceThreshold computes the smallest Levenshtein distance between
+// a prefix and the beginnings of a target string, if and only if it is smaller
+// than a specific threshold. It tells how far the target is from completing
+// what has been typed so far, so "fuzz" is at distance 0 from "fuzzyguy".
+//
+// Arugments:
+// prefix (string): the typed text
+// target (string): the string which may complete it
+// threshold (int): the threshold of the Levenshtein distance
+//
+// Returns: (int, bool) the distance and if it is lower than the threshold.
+// The first value is valid iff the second one is true.
+func PrefixDistanceThreshold(prefix, target string, threshold int) (int, bool) {
+	return prefixDistanceThreshold([]rune(prefix), []rune(target), threshold, new(buffers))
+}
+
+func prefixDistanceThreshold(prefix, target []rune, threshold int, rows *buffers) (int, bool) {
+	prefixLen := len(prefix)
+	// Beginnings longer than this are further than the threshold
+	targetLen := min(len(target), prefixLen+threshold)
+	if prefixLen-targetLen > threshold || threshold < 0 {
+		return -1, false
+	}
+
+	v0, v1, _ := rows.ints(targetLen + 1)
+
+	for i := 0; i <= targetLen; i++ {
+		v0[i] = i
+	}
+
+	infinity := threshold + 1
+	cost, lower := 0, 0 // Lower bound at each step
+	for i := 1; i <= prefixLen; i++ {
+		start, stop := max(0, i-threshold), min(targetLen, i+threshold)
+		if previous := min(targetLen, i-1+threshold); previous < targetLen {
+			v0[previous+1] = infinity
+		}
+		if start == 0 {
+			v1[start] = i
+		} else {
 			cost = 0
-			if source[i] != target[j] {
+			if prefix[i-1] != target[start-1] {
 				cost = 1
 			}
-			v1[j+1] = min3(v1[j]+1, v0[j+1]+1, v0[j]+cost)
-			lower = min(v1[j+1], lower)
+			v1[start] = min(v0[start]+1, v0[start-1]+cost)
 		}
-		cost = 0
-		if source[i] != target[stop-1] {
-			cost = 1
+		lower = v1[start]
+		for j := start + 1; j <= stop; j++ {
+			cost = 0
+			if prefix[i-1] != target[j-1] {
+				cost = 1
+			}
+			v1[j] = min3(v1[j-1]+1, v0[j]+1, v0[j-1]+cost)
+			lower = min(v1[j], lower)
 		}
-		v1[stop] = min(v1[stop-1]+1, v0[stop-1]+cost)
-		lower = min(v1[stop], lower)
 		// If the lower bound is higher than the threshold we return false
 		if lower > threshold {
 			return -1, false
@@ -102,6 +224,94 @@ func DistanceThreshold(source, target string, threshold int) (int, bool) {
 		v0, v1 = v1, v0
 	}
 
+	// The best beginning of the target is anywhere within the last band
+	best := infinity
+	for j := max(0, prefixLen-threshold); j <= min(targetLen, prefixLen+threshold); j++ {
+		best = min(best, v0[j])
+	}
+	return best, best <= threshold
+}
+
+// DamerauThreshold computes the Optimal String Alignment distance between
+// two strings if and only if it is smaller than a specific threshold. This is
+// the Levenshtein distance where swapping two adjacent runes also costs a
+// single edit, as long as no substring is edited more than once.
+//
+// Arugments:
+// source, target (string): the two strings to compute the distance for
+// threshold (int): the threshold of the distance
+//
+// Returns: (int, bool) the distance and if it is lower than the threshold.
+// The first value is valid iff the second one is true.
+func DamerauThreshold(source, target string, threshold int) (int, bool) {
+	return damerauThreshold([]rune(source), []rune(target), threshold, new(buffers))
+}
+
+func damerauThreshold(source, target []rune, threshold int, rows *buffers) (int, bool) {
+	sourceLen := len(source)
+	targetLen := len(target)
+
+	if sourceLen > targetLen {
+		source, target = target, source
+		sourceLen, targetLen = targetLen, sourceLen
+	}
+
+	diff := targetLen - sourceLen
+	// The length difference alone is a lower bound for the distance
+	if diff > threshold {
+		return -1, false
+	}
+	if threshold <= 0 {
+		return distanceThreshold(source, target, threshold)
+	}
+
+	// v2 holds the row before v0, which is needed for transpositions
+	v2, v0, v1 := rows.ints(targetLen + 1)
+
+	for i := 0; i <= targetLen; i++ {
+		v0[i] = i
+	}
+
+	// Cells outside of the band can not lead to a distance within the
+	// threshold, so we treat them as being infinitely far away. A path which
+	// transposes two runes skips a row, but the row it skips always holds a
+	// cell at most as far as the transposed one, so the early exit on the
+	// lower bound of each row stays correct.
+	infinity := threshold + 1
+	cost, lower := 0, 0 // Lower bound at each step
+	for i := 1; i <= sourceLen; i++ {
+		start, stop := max(0, i-threshold), min(targetLen, i+diff+threshold)
+		if previous := min(targetLen, i-1+diff+threshold); previous < targetLen {
+			v0[previous+1] = infinity
+		}
+		if start == 0 {
+			v1[start] = i
+		} else {
+			cost = 0
+			if source[i-1] != target[start-1] {
+				cost = 1
+			}
+			v1[start] = min(v0[start]+1, v0[start-1]+cost)
+		}
+		lower = v1[start]
+		for j := start + 1; j <= stop; j++ {
+			cost = 0
+			if source[i-1] != target[j-1] {
+				cost = 1
+			}
+			v1[j] = min3(v1[j-1]+1, v0[j]+1, v0[j-1]+cost)
+			if i > 1 && j > 1 && source[i-1] == target[j-2] && source[i-2] == target[j-1] {
+				v1[j] = min(v1[j], v2[j-2]+1)
+			}
+			lower = min(v1[j], lower)
+		}
+		// If the lower bound is higher than the threshold we return false
+		if lower > threshold {
+			return -1, false
+		}
+		v2, v0, v1 = v0, v1, v2
+	}
+
 	return v0[targetLen], v0[targetLen] <= threshold
 
 }
@@ -1,6 +1,8 @@
 package levenshtein
 
 import (
+	"math/rand"
+	"strings"
 	"testing"
 )
 
@@ -55,6 +57,302 @@ func TestDistanceThreshold(t *testing.T) {
 	}
 }
 
+func TestDistanceThresholdUnicode(t *testing.T) {
+	threshold := 2
+	var testCases = []struct {
+		source   string
+		target   string
+		distance int
+		within   bool
+	}{
+		{"café", "cafe", 1, true},
+		{"café", "café", 0, true},
+		{"naïve", "naive", 1, true},
+		{"élève", "eleve", 2, true},
+		{"élèvé", "eleve", -1, false},
+		{"日本語", "日本", 1, true},
+		{"ça", "ca", 1, true},
+		{"hôpital", "hopital", 1, true},
+		{"œuvre", "oeuvre", 2, true},
+	}
+	for _, testCase := range testCases {
+		distance, within := DistanceThreshold(testCase.source, testCase.target, threshold)
+		if within != testCase.within || (within && distance != testCase.distance) {
+			t.Log("Distance between",
+				testCase.source,
+				"and",
+				testCase.target,
+				"computed as",
+				distance,
+				within,
+				", should be",
+				testCase.distance,
+				testCase.within)
+			t.Error("Failed to compute the Levenshtein distance over runes")
+		}
+	}
+}
+
+// referenceDistance computes the Levenshtein distance using the full matrix
+func referenceDistance(source, target []rune) int {
+	m := newMatrix(len(source)+1, len(target)+1)
+	for i := range m {
+		m[i][0] = i
+	}
+	for j := range m[0] {
+		m[0][j] = j
+	}
+	for i := 1; i <= len(source); i++ {
+		for j := 1; j <= len(target); j++ {
+			cost := 1
+			if source[i-1] == target[j-1] {
+				cost = 0
+			}
+			m[i][j] = min3(m[i-1][j]+1, m[i][j-1]+1, m[i-1][j-1]+cost)
+		}
+	}
+	return m[len(source)][len(target)]
+}
+
+func randomRunes(r *rand.Rand, alphabet []rune, maxLen int) []rune {
+	s := make([]rune, r.Intn(maxLen+1))
+	for i := range s {
+		s[i] = alphabet[r.Intn(len(alphabet))]
+	}
+	return s
+}
+
+func TestDistanceThresholdReference(t *testing.T) {
+	r := rand.New(rand.NewSource(42))
+	alphabet := []rune("abcé")
+	for n := 0; n < 50000; n++ {
+		source, target := randomRunes(r, alphabet, 8), randomRunes(r, alphabet, 8)
+		threshold := r.Intn(5)
+		expected := referenceDistance(source, target)
+		distance, within := DistanceThreshold(string(source), string(target), threshold)
+		if within != (expected <= threshold) || (within && distance != expected) {
+			t.Log("Distance between",
+				string(source),
+				"and",
+				string(target),
+				"with threshold",
+				threshold,
+				"computed as",
+				distance,
+				", should be",
+				expected)
+			t.Fatal("Banded distance differs from the full matrix")
+		}
+	}
+}
+
+// TestMyersReference checks the bit-parallel distance against the banded
+// one and the full matrix, with patterns filling one word, a few words and a
+// partial last word
+func TestMyersReference(t *testing.T) {
+	r := rand.New(rand.NewSource(7))
+	alphabet := []rune("abcdé日")
+	for n := 0; n < 20000; n++ {
+		maxLen := []int{8, 64, 70, 200}[n%4]
+		source, target := randomRunes(r, alphabet, maxLen), randomRunes(r, alphabet, maxLen)
+		if r.Intn(2) == 0 {
+			/* Close strings exercise distances within the threshold */
+			target = append([]rune{}, source...)
+			for edits := r.Intn(4); edits > 0 && len(target) > 0; edits-- {
+				target[r.Intn(len(target))] = alphabet[r.Intn(len(alphabet))]
+			}
+		}
+		threshold := r.Intn(maxLen/2 + 2)
+		expected := referenceDistance(source, target)
+		bandedDistance, bandedWithin := bandedDistanceThreshold(source, target, threshold)
+		distance, within := distanceThreshold(source, target, threshold)
+		if within != (expected <= threshold) || (within && distance != expected) ||
+			within != bandedWithin || (within && distance != bandedDistance) {
+			t.Log("Distance between",
+				string(source),
+				"and",
+				string(target),
+				"with threshold",
+				threshold,
+				"computed as",
+				distance,
+				", should be",
+				expected)
+			t.Fatal("Bit-parallel distance differs from the dynamic programming one")
+		}
+	}
+}
+
+// referenceDamerau computes the Optimal String Alignment distance using the
+// full matrix
+func referenceDamerau(source, target []rune) int {
+	m := newMatrix(len(source)+1, len(target)+1)
+	for i := range m {
+		m[i][0] = i
+	}
+	for j := range m[0] {
+		m[0][j] = j
+	}
+	for i := 1; i <= len(source); i++ {
+		for j := 1; j <= len(target); j++ {
+			cost := 1
+			if source[i-1] == target[j-1] {
+				cost = 0
+			}
+			m[i][j] = min3(m[i-1][j]+1, m[i][j-1]+1, m[i-1][j-1]+cost)
+			if i > 1 && j > 1 && source[i-1] == target[j-2] && source[i-2] == target[j-1] {
+				m[i][j] = min(m[i][j], m[i-2][j-2]+1)
+			}
+		}
+	}
+	return m[len(source)][len(target)]
+}
+
+func TestDamerauThreshold(t *testing.T) {
+	threshold := 2
+	var testCases = []struct {
+		source   string
+		target   string
+		distance int
+		within   bool
+	}{
+		{"teh", "the", 1, true},
+		{"the", "teh", 1, true},
+		{"abcd", "badc", 2, true},
+		{"ca", "abc", -1, false},
+		{"", "aa", 2, true},
+		{"a", "bcaa", -1, false},
+		{"aaa", "aba", 1, true},
+		{"informatica", "infromatcia", 2, true},
+		{"élève", "éelve", 2, true},
+		{"café", "caéf", 1, true},
+		{"abc", "", -1, false},
+	}
+	for _, testCase := range testCases {
+		distance, within := DamerauThreshold(testCase.source, testCase.target, threshold)
+		if within != testCase.within || (within && distance != testCase.distance) {
+			t.Log("Distance between",
+				testCase.source,
+				"and",
+				testCase.target,
+				"computed as",
+				distance,
+				within,
+				", should be",
+				testCase.distance,
+				testCase.within)
+			t.Error("Failed to compute the Damerau distance")
+		}
+	}
+}
+
+func TestDamerauThresholdReference(t *testing.T) {
+	r := rand.New(rand.NewSource(42))
+	alphabet := []rune("abcé")
+	for n := 0; n < 50000; n++ {
+		source, target := randomRunes(r, alphabet, 8), randomRunes(r, alphabet, 8)
+		threshold := r.Intn(5)
+		expected := referenceDamerau(source, target)
+		distance, within := DamerauThreshold(string(source), string(target), threshold)
+		if within != (expected <= threshold) || (within && distance != expected) {
+			t.Log("Distance between",
+				string(source),
+				"and",
+				string(target),
+				"with threshold",
+				threshold,
+				"computed as",
+				distance,
+				", should be",
+				expected)
+			t.Fatal("Banded distance differs from the full matrix")
+		}
+	}
+}
+
+// The histogram filters are shared by both metrics, so they must bound the
+// Damerau distance as well
+func TestLowerBoundDamerau(t *testing.T) {
+	r := rand.New(rand.NewSource(7))
+	alphabet := []rune("abcdé")
+	for n := 0; n < 50000; n++ {
+		source, target := randomRunes(r, alphabet, 8), randomRunes(r, alphabet, 8)
+		distance := referenceDamerau(source, target)
+		lengthDiff := abs(len(source) - len(target))
+		lower := LowerBound(ComputeHistogram(string(source)), ComputeHistogram(string(target)), lengthDiff)
+		extended := ExtendedLowerBound(ComputeExtendedHistogram(string(source)),
+			ComputeExtendedHistogram(string(target)), lengthDiff)
+		if lower > distance || extended > distance {
+			t.Log(string(source), string(target), distance, lower, extended)
+			t.Fatal("Lower bound is higher than the Damerau distance")
+		}
+	}
+}
+
+func TestPrefixDistanceThreshold(t *testing.T) {
+	threshold := 1
+	var testCases = []struct {
+		prefix   string
+		target   string
+		distance int
+		within   bool
+	}{
+		{"fuzz", "fuzzyguy", 0, true},
+		{"fuzy", "fuzzyguy", 1, true},
+		{"fyzz", "fuzzyguy", 1, true},
+		{"", "fuzzyguy", 0, true},
+		{"fuzzyguys", "fuzzyguy", 1, true},
+		{"fuzzyguyss", "fuzzyguy", -1, false},
+		{"guy", "fuzzyguy", -1, false},
+		{"caf", "café", 0, true},
+		{"cafe", "cafés", 1, true},
+		{"élé", "éléphant", 0, true},
+	}
+	for _, testCase := range testCases {
+		distance, within := PrefixDistanceThreshold(testCase.prefix, testCase.target, threshold)
+		if within != testCase.within || (within && distance != testCase.distance) {
+			t.Log("Prefix distance between",
+				testCase.prefix,
+				"and",
+				testCase.target,
+				"computed as",
+				distance,
+				within,
+				", should be",
+				testCase.distance,
+				testCase.within)
+			t.Error("Failed to compute the prefix distance")
+		}
+	}
+}
+
+func TestPrefixDistanceThresholdReference(t *testing.T) {
+	r := rand.New(rand.NewSource(11))
+	alphabet := []rune("abcé")
+	for n := 0; n < 50000; n++ {
+		prefix, target := randomRunes(r, alphabet, 6), randomRunes(r, alphabet, 10)
+		threshold := r.Intn(4)
+		expected := len(prefix)
+		for j := 0; j <= len(target); j++ {
+			expected = min(expected, referenceDistance(prefix, target[:j]))
+		}
+		distance, within := PrefixDistanceThreshold(string(prefix), string(target), threshold)
+		if within != (expected <= threshold) || (within && distance != expected) {
+			t.Log("Prefix distance between",
+				string(prefix),
+				"and",
+				string(target),
+				"with threshold",
+				threshold,
+				"computed as",
+				distance,
+				", should be",
+				expected)
+			t.Fatal("Banded prefix distance differs from the full matrix")
+		}
+	}
+}
+
 func BenchmarkLevenshteinThreshold(b *testing.B) {
 	source := "informatcia supre"
 	target := "informatica super"
@@ -63,6 +361,60 @@ func BenchmarkLevenshteinThreshold(b *testing.B) {
 	}
 }
 
+// The Matcher benchmarks report their allocations, which are none once the
+// buffers have grown to the length of the candidates
+
+func BenchmarkMatcherLevenshteinThreshold(b *testing.B) {
+	matcher := NewMatcher("informatcia supre")
+	target := "informatica super"
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		matcher.DistanceThreshold(target, 3)
+	}
+}
+
+func BenchmarkMatcherDamerauThreshold(b *testing.B) {
+	matcher := NewMatcher("informatcia supre")
+	target := "informatica super"
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		matcher.DamerauThreshold(target, 3)
+	}
+}
+
+func BenchmarkMatcherLevenshteinThresholdLong(b *testing.B) {
+	matcher := NewMatcher(strings.Repeat("informatcia supre ", 6))
+	target := strings.Repeat("informatica super ", 6)
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		matcher.DistanceThreshold(target, 30)
+	}
+}
+
+func BenchmarkBandedLevenshteinThreshold(b *testing.B) {
+	source := []rune("informatcia supre")
+	target := []rune("informatica super")
+	for n := 0; n < b.N; n++ {
+		bandedDistanceThreshold(source, target, 3)
+	}
+}
+
+func BenchmarkLevenshteinThresholdLong(b *testing.B) {
+	source := strings.Repeat("informatcia supre ", 6)
+	target := strings.Repeat("informatica super ", 6)
+	for n := 0; n < b.N; n++ {
+		DistanceThreshold(source, target, 30)
+	}
+}
+
+func BenchmarkDamerauThreshold(b *testing.B) {
+	source := "informatcia supre"
+	target := "informatica super"
+	for n := 0; n < b.N; n++ {
+		DamerauThreshold(source, target, 3)
+	}
+}
+
 func BenchmarkLevenshteinThresholdStop(b *testing.B) {
 	source := "informaticasapre"
 	target := "informatica super"
@@ -0,0 +1,148 @@
+package levenshtein
+
+// buffers holds the rows of the dynamic programming matrices, along with the
+// flags of the matched runes of the Jaro-Winkler similarity, so that they may
+// be reused from one computation to the next
+type buffers struct {
+	intRows   [3][]int
+	floatRows [3][]float64
+	flagRows  [2][]bool
+}
+
+// ints returns three rows of n integers, whose content is not cleared
+func (rows *buffers) ints(n int) ([]int, []int, []int) {
+	for i := range rows.intRows {
+		if cap(rows.intRows[i]) < n {
+			rows.intRows[i] = make([]int, n)
+		}
+		rows.intRows[i] = rows.intRows[i][:n]
+	}
+	return rows.intRows[0], rows.intRows[1], rows.intRows[2]
+}
+
+// floats returns three rows of n floats, whose content is not cleared
+func (rows *buffers) floats(n int) ([]float64, []float64, []float64) {
+	for i := range rows.floatRows {
+		if cap(rows.floatRows[i]) < n {
+			rows.floatRows[i] = make([]float64, n)
+		}
+		rows.floatRows[i] = rows.floatRows[i][:n]
+	}
+	return rows.floatRows[0], rows.floatRows[1], rows.floatRows[2]
+}
+
+// flags returns two cleared rows of n and m flags
+func (rows *buffers) flags(n, m int) ([]bool, []bool) {
+	for i, length := range [2]int{n, m} {
+		if cap(rows.flagRows[i]) < length {
+			rows.flagRows[i] = make([]bool, length)
+		}
+		rows.flagRows[i] = rows.flagRows[i][:length]
+		for j := range rows.flagRows[i] {
+			rows.flagRows[i][j] = false
+		}
+	}
+	return rows.flagRows[0], rows.flagRows[1]
+}
+
+// Matcher computes the distances between a query and many candidates, such
+// as the keys of a store. The query is prepared once and every buffer is
+// reused from one candidate to the next, so once they have grown to the
+// length of the longest candidate no computation allocates anything.
+//
+// The zero Matcher has an empty query. A Matcher may not be used by several
+// goroutines at once, every goroutine of a query should have its own.
+type Matcher struct {
+	query   []rune
+	pattern bitPattern
+	target  []rune
+	rows    buffers
+}
+
+// NewMatcher creates a Matcher computing the distances to a query.
+//
+// Arguments:
+// query (string): the string every candidate is compared to
+//
+// Returns: (*Matcher) the matcher
+func NewMatcher(query string) *Matcher {
+	matcher := new(Matcher)
+	matcher.Reset(query)
+	return matcher
+}
+
+// Reset changes the query of the matcher, keeping its buffers.
+//
+// Arguments:
+// query (string): the string every candidate is compared to
+func (matcher *Matcher) Reset(query string) {
+	matcher.query = appendRunes(matcher.query[:0], query)
+	matcher.pattern.reset(matcher.query)
+}
+
+// appendRunes decodes a string into a buffer of runes, like []rune(s) does
+// without allocating a new slice
+func appendRunes(buffer []rune, s string) []rune {
+	for _, r := range s {
+		buffer = append(buffer, r)
+	}
+	return buffer
+}
+
+func (matcher *Matcher) decode(target string) []rune {
+	matcher.target = appendRunes(matcher.target[:0], target)
+	return matcher.target
+}
+
+// DistanceThreshold works just like the DistanceThreshold function, between
+// the query and a candidate.
+//
+// Arguments:
+// target (string): the candidate
+// threshold (int): the threshold of the Levenshtein distance
+//
+// Returns: (int, bool) the distance and if it is lower than the threshold.
+// The first value is valid iff the second one is true.
+func (matcher *Matcher) DistanceThreshold(target string, threshold int) (int, bool) {
+	runes := matcher.decode(target)
+	if distance, within, settled := trivialDistance(matcher.query, runes, threshold); settled {
+		return distance, within
+	}
+	return matcher.pattern.distanceThreshold(runes, threshold)
+}
+
+// DamerauThreshold works just like the DamerauThreshold function, between
+// the query and a candidate.
+func (matcher *Matcher) DamerauThreshold(target string, threshold int) (int, bool) {
+	return damerauThreshold(matcher.query, matcher.decode(target), threshold, &matcher.rows)
+}
+
+// PrefixDistanceThreshold works just like the PrefixDistanceThreshold
+// function, with the query as the prefix.
+func (matcher *Matcher) PrefixDistanceThreshold(target string, threshold int) (int, bool) {
+	return prefixDistanceThreshold(matcher.query, matcher.decode(target), threshold, &matcher.rows)
+}
+
+// WeightedDistanceThreshold works just like the WeightedDistanceThreshold
+// function, from the query to a candidate.
+func (matcher *Matcher) WeightedDistanceThreshold(target string, threshold float64, costs CostModel) (float64, bool) {
+	return weightedThreshold(matcher.query, matcher.decode(target), threshold, costs, false, &matcher.rows)
+}
+
+// WeightedDamerauThreshold works just like the WeightedDamerauThreshold
+// function, from the query to a candidate.
+func (matcher *Matcher) WeightedDamerauThreshold(target string, threshold float64, costs CostModel) (float64, bool) {
+	return weightedThreshold(matcher.query, matcher.decode(target), threshold, costs, true, &matcher.rows)
+}
+
+// WeightedPrefixDistanceThreshold works just like the
+// WeightedPrefixDistanceThreshold function, from the query to a candidate.
+func (matcher *Matcher) WeightedPrefixDistanceThreshold(target string, threshold float64, costs CostModel) (float64, bool) {
+	return weightedPrefixThreshold(matcher.query, matcher.decode(target), threshold, costs, &matcher.rows)
+}
+
+// JaroWinklerThreshold works just like the JaroWinklerThreshold function,
+// between the query and a candidate.
+func (matcher *Matcher) JaroWinklerThreshold(target string, minSimilarity float64) (float64, bool) {
+	return jaroWinklerThreshold(matcher.query, matcher.decode(target), minSimilarity, &matcher.rows)
+}
@@ -0,0 +1,66 @@
+package levenshtein
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// TestMatcherReference checks that a Matcher reused over candidates of every
+// length computes the same distances as the functions
+func TestMatcherReference(t *testing.T) {
+	r := rand.New(rand.NewSource(11))
+	alphabet := []rune("abcé日")
+	costs := newRandomCosts(r, alphabet)
+	matcher := NewMatcher("")
+	for n := 0; n < 200; n++ {
+		maxLen := []int{6, 30, 90}[n%3]
+		query := string(randomRunes(r, alphabet, maxLen))
+		matcher.Reset(query)
+		for c := 0; c < 50; c++ {
+			target := string(randomRunes(r, alphabet, maxLen))
+			threshold := r.Intn(maxLen/3 + 2)
+
+			expected, expectedWithin := DistanceThreshold(query, target, threshold)
+			if distance, within := matcher.DistanceThreshold(target, threshold); distance != expected || within != expectedWithin {
+				t.Fatal("Matcher distance between", query, "and", target, "is", distance, "instead of", expected)
+			}
+			expected, expectedWithin = DamerauThreshold(query, target, threshold)
+			if distance, within := matcher.DamerauThreshold(target, threshold); distance != expected || within != expectedWithin {
+				t.Fatal("Matcher Damerau distance between", query, "and", target, "is", distance, "instead of", expected)
+			}
+			expected, expectedWithin = PrefixDistanceThreshold(query, target, threshold)
+			if distance, within := matcher.PrefixDistanceThreshold(target, threshold); distance != expected || within != expectedWithin {
+				t.Fatal("Matcher prefix distance between", query, "and", target, "is", distance, "instead of", expected)
+			}
+			similarity, similar := JaroWinklerThreshold(query, target, 0.8)
+			if matched, within := matcher.JaroWinklerThreshold(target, 0.8); matched != similarity || within != similar {
+				t.Fatal("Matcher similarity between", query, "and", target, "is", matched, "instead of", similarity)
+			}
+			weighted, weightedWithin := WeightedDamerauThreshold(query, target, float64(threshold), costs)
+			if distance, within := matcher.WeightedDamerauThreshold(target, float64(threshold), costs); distance != weighted || within != weightedWithin {
+				t.Fatal("Matcher weighted distance between", query, "and", target, "is", distance, "instead of", weighted)
+			}
+		}
+	}
+}
+
+func TestMatcherAllocations(t *testing.T) {
+	for _, query := range []string{"informatica super", strings.Repeat("informatica super ", 6)} {
+		matcher := NewMatcher(query)
+		candidates := []string{"informatcia supre", "fmi unibuc", "", strings.Repeat("informatcia supre ", 6)}
+		matcher.DamerauThreshold(candidates[3], 40)
+		allocations := testing.AllocsPerRun(100, func() {
+			for _, candidate := range candidates {
+				matcher.DistanceThreshold(candidate, 40)
+				matcher.DamerauThreshold(candidate, 40)
+				matcher.PrefixDistanceThreshold(candidate, 40)
+				matcher.WeightedDistanceThreshold(candidate, 40, UnitCosts{})
+				matcher.JaroWinklerThreshold(candidate, 0.5)
+			}
+		})
+		if allocations != 0 {
+			t.Error("Matcher allocated", allocations, "times per run for a query of", len(query), "bytes")
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package levenshtein
+
+/* The Levenshtein distance is computed with the bit-parallel algorithm of
+   Myers, in the formulation of Hyyrö. Instead of the cells of the dynamic
+   programming matrix it keeps the differences between adjacent cells of a
+   column, which are always -1, 0 or +1, as bit vectors: Pv holds the rows
+   where the difference is +1 and Mv the ones where it is -1. A whole column
+   is then computed from the previous one with a handful of word operations.
+
+   One of the strings is the pattern, whose runes index the rows. Patterns of
+   up to 64 runes fit in a single word, longer ones are split in blocks of 64
+   rows which pass the horizontal difference of their last row on to the next
+   block. Preparing the pattern costs as much as a few columns, so a Matcher
+   prepares its query once for all the candidates. */
+
+const wordBits = 64
+
+// runeMask is the bit vector of the rows of the pattern holding a rune
+type runeMask struct {
+	r    rune
+	mask uint64
+}
+
+// patternMasks holds, for every rune of a pattern of at most 64 runes, the
+// rows holding it. ASCII runes are looked up directly, the few other ones are
+// searched for. It is small enough to live on the stack.
+type patternMasks struct {
+	ascii  [128]uint64
+	others [wordBits]runeMask
+	count  int
+}
+
+func (masks *patternMasks) get(r rune) uint64 {
+	if uint32(r) < 128 {
+		return masks.ascii[r]
+	}
+	for i := 0; i < masks.count; i++ {
+		if masks.others[i].r == r {
+			return masks.others[i].mask
+		}
+	}
+	return 0
+}
+
+func (masks *patternMasks) add(r rune, bit uint64) {
+	if uint32(r) < 128 {
+		masks.ascii[r] |= bit
+		return
+	}
+	for i := 0; i < masks.count; i++ {
+		if masks.others[i].r == r {
+			masks.others[i].mask |= bit
+			return
+		}
+	}
+	masks.others[masks.count] = runeMask{r, bit}
+	masks.count++
+}
+
+// blockMasks holds, for every rune of a pattern longer than 64 runes, the
+// rows holding it in every block, along with the bit vectors of the current
+// column. Every distinct rune gets a position, offset by one so that the
+// position 0 holds the empty masks of the runes which are not in the pattern.
+type blockMasks struct {
+	blocks int
+	ascii  [128]int
+	others map[rune]int
+	masks  []uint64
+	pv, mv []uint64
+}
+
+func (masks *blockMasks) position(r rune) int {
+	if uint32(r) < 128 {
+		return masks.ascii[r]
+	}
+	return masks.others[r]
+}
+
+func (masks *blockMasks) reset(pattern []rune) {
+	masks.blocks = (len(pattern) + wordBits - 1) / wordBits
+	masks.ascii = [128]int{}
+	for r := range masks.others {
+		delete(masks.others, r)
+	}
+	masks.masks = append(masks.masks[:0], make([]uint64, masks.blocks)...)
+	for i, r := range pattern {
+		p := masks.position(r)
+		if p == 0 {
+			p = len(masks.masks) / masks.blocks
+			if uint32(r) < 128 {
+				masks.ascii[r] = p
+			} else {
+				if masks.others == nil {
+					masks.others = make(map[rune]int)
+				}
+				masks.others[r] = p
+			}
+			masks.masks = append(masks.masks, make([]uint64, masks.blocks)...)
+		}
+		masks.masks[p*masks.blocks+i/wordBits] |= 1 << uint(i%wordBits)
+	}
+	if cap(masks.pv) < masks.blocks {
+		masks.pv, masks.mv = make([]uint64, masks.blocks), make([]uint64, masks.blocks)
+	}
+	masks.pv, masks.mv = masks.pv[:masks.blocks], masks.mv[:masks.blocks]
+}
+
+// bitPattern is a pattern prepared for the bit-parallel computation of its
+// distance to any text
+type bitPattern struct {
+	length int
+	word   patternMasks
+	long   *blockMasks
+}
+
+func (pattern *bitPattern) reset(runes []rune) {
+	pattern.length = len(runes)
+	if len(runes) > wordBits {
+		if pattern.long == nil {
+			pattern.long = new(blockMasks)
+		}
+		pattern.long.reset(runes)
+		return
+	}
+	pattern.word = patternMasks{}
+	for i, r := range runes {
+		pattern.word.add(r, 1<<uint(i))
+	}
+}
+
+// distanceThreshold computes the Levenshtein distance between the pattern
+// and a text, if and only if it is smaller than a threshold. The pattern may
+// not be empty.
+func (pattern *bitPattern) distanceThreshold(text []rune, threshold int) (int, bool) {
+	if pattern.length > wordBits {
+		return pattern.long.distanceThreshold(pattern.length, text, threshold)
+	}
+
+	last := uint64(1) << uint(pattern.length-1)
+	pv, mv := ^uint64(0), uint64(0)
+	score := pattern.length
+	for j, r := range text {
+		eq := pattern.word.get(r)
+		xv := eq | mv
+		xh := (((eq & pv) + pv) ^ pv) | eq
+		ph := mv | ^(xh | pv)
+		mh := pv & xh
+		if ph&last != 0 {
+			score++
+		} else if mh&last != 0 {
+			score--
+		}
+		// The first row of the matrix grows by one with every column
+		ph = ph<<1 | 1
+		mh <<= 1
+		pv = mh | ^(xv | ph)
+		mv = ph & xv
+
+		// The last row can not decrease by more than one per column left
+		if score-(len(text)-j-1) > threshold {
+			return -1, false
+		}
+	}
+	return score, score <= threshold
+}
+
+// distanceThreshold works like the one of bitPattern for patterns longer
+// than 64 runes, which are split in blocks of 64 rows
+func (masks *blockMasks) distanceThreshold(length int, text []rune, threshold int) (int, bool) {
+	blocks, pv, mv := masks.blocks, masks.pv, masks.mv
+	for b := range pv {
+		pv[b], mv[b] = ^uint64(0), 0
+	}
+	last := uint64(1) << uint((length-1)%wordBits)
+	score := length
+	for j, r := range text {
+		p := masks.position(r) * blocks
+		eqs := masks.masks[p : p+blocks]
+
+		// The first row of the matrix grows by one with every column
+		hin := 1
+		for b := 0; b < blocks; b++ {
+			high := uint64(1) << (wordBits - 1)
+			if b == blocks-1 {
+				high = last
+			}
+			eq := eqs[b]
+			xv := eq | mv[b]
+			if hin < 0 {
+				eq |= 1
+			}
+			xh := (((eq & pv[b]) + pv[b]) ^ pv[b]) | eq
+			ph := mv[b] | ^(xh | pv[b])
+			mh := pv[b] & xh
+
+			hout := 0
+			if ph&high != 0 {
+				hout = 1
+			} else if mh&high != 0 {
+				hout = -1
+			}
+			ph <<= 1
+			mh <<= 1
+			if hin < 0 {
+				mh |= 1
+			} else if hin > 0 {
+				ph |= 1
+			}
+			pv[b] = mh | ^(xv | ph)
+			mv[b] = ph & xv
+			hin = hout
+		}
+		score += hin
+
+		// The last row can not decrease by more than one per column left
+		if score-(len(text)-j-1) > threshold {
+			return -1, false
+		}
+	}
+	return score, score <= threshold
+}
@@ -0,0 +1,145 @@
+package phonetic
+
+import (
+	"strings"
+)
+
+/* The French encoder rewrites a word the way it is pronounced, with a small
+   set of rules in the spirit of the French Soundex and Phonex adaptations.
+   Unlike Soundex and Metaphone it keeps the vowels, since many French words
+   only differ by them, but spells every sound a single way:
+
+   - the silent endings are dropped: "physique" is read "physiqu", "vingt"
+     "vin", and "parler", "parlez" and "parlé" are all read "parle",
+   - the groups of letters standing for a single sound are replaced by it:
+     "eau" and "au" are O, "ou" is U, "ph" is F, "qu" is K, "ch" is X,
+   - C and G are soft before E, I and Y, S and Z are both S, the nasal vowels
+     are 1 for "an" and "en", 2 for "in", "ain" and "un", and 3 for "on",
+   - a sound repeated by doubled letters is only kept once.
+
+   So "physique" and "fizzik" are both FISIK, "chapeau" and "chapo" XAPO. */
+
+// French encodes words by how they are pronounced in French.
+type French struct{}
+
+// frenchRule replaces a group of letters by its sound, when the letters
+// around it allow it
+type frenchRule struct {
+	letters string
+	sound   string
+	when    func(word string, start, end int) bool
+}
+
+func isFrenchVowel(b byte) bool {
+	return strings.IndexByte("aeiouy", b) >= 0
+}
+
+// beforeSoft tells whether the group is followed by E, I or Y
+func beforeSoft(word string, start, end int) bool {
+	return end < len(word) && strings.IndexByte("eiy", word[end]) >= 0
+}
+
+// beforeHard tells whether the group is followed by A, O or U
+func beforeHard(word string, start, end int) bool {
+	return end < len(word) && strings.IndexByte("aou", word[end]) >= 0
+}
+
+// nasal tells whether the group ends the syllable, so that its vowel is
+// nasal: it is not followed by a vowel, nor by another N or M as in "bonne"
+func nasal(word string, start, end int) bool {
+	return end == len(word) || !isFrenchVowel(word[end]) && word[end] != 'n' && word[end] != 'm'
+}
+
+// atEnd tells whether the group ends the word
+func atEnd(word string, start, end int) bool {
+	return end == len(word)
+}
+
+// frenchRules holds the rules starting with every letter, the longest groups
+// first, since they are tried in order
+var frenchRules = map[byte][]frenchRule{
+	'a': {{"aill", "AI", nil}, {"ail", "AI", atEnd}, {"ain", "2", nasal}, {"aim", "2", nasal},
+		{"au", "O", nil}, {"ai", "E", nil}, {"ay", "E", nil}, {"an", "1", nasal}, {"am", "1", nasal}},
+	'c': {{"ch", "X", nil}, {"ck", "K", nil}, {"cc", "KS", beforeSoft}, {"c", "S", beforeSoft}},
+	'e': {{"eill", "EI", nil}, {"eil", "EI", atEnd}, {"eau", "O", nil}, {"ein", "2", nasal}, {"eim", "2", nasal},
+		{"ei", "E", nil}, {"eu", "E", nil}, {"en", "1", nasal}, {"em", "1", nasal}},
+	'g': {{"gu", "G", beforeSoft}, {"ge", "J", beforeHard}, {"gn", "NI", nil}, {"g", "J", beforeSoft}},
+	'i': {{"ien", "I2", nasal}, {"in", "2", nasal}, {"im", "2", nasal}, {"ie", "I", nil}},
+	'o': {{"ouill", "UI", nil}, {"ouil", "UI", atEnd}, {"oin", "W2", nasal}, {"oeu", "E", nil},
+		{"oi", "WA", nil}, {"oy", "WA", nil}, {"ou", "U", nil}, {"on", "3", nasal}, {"om", "3", nasal}},
+	'p': {{"ph", "F", nil}},
+	'q': {{"qu", "K", nil}},
+	's': {{"sch", "X", nil}, {"sh", "X", nil}},
+	't': {{"tion", "SI3", nil}, {"th", "T", nil}},
+	'u': {{"un", "2", nasal}, {"um", "2", nasal}},
+	'y': {{"yn", "2", nasal}, {"ym", "2", nasal}},
+}
+
+// frenchLetters holds the sound of the letters not replaced by a rule, the
+// H being silent
+var frenchLetters = [26]string{
+	"A", "B", "K", "D", "E", "F", "G", "", "I", "J", "K", "L", "M",
+	"N", "O", "P", "K", "R", "S", "T", "Y", "V", "V", "KS", "I", "S",
+}
+
+// frenchSilent holds the consonants which are not pronounced at the end of
+// a word
+const frenchSilent = "dgpstxz"
+
+// frenchEndings are the endings where a final E is pronounced, thanks to its
+// accent. They are spelled like the ending of "parlez" before the accents are
+// dropped, so that they sound like the other endings of the verbs.
+var frenchEndings = []string{"ées", "és", "ée", "é"}
+
+// frenchCedilla replaces the letters whose mark changes their sound
+var frenchCedilla = strings.NewReplacer("Ç", "S", "Ñ", "N")
+
+// Encode returns the French code of a word
+func (French) Encode(word string) []string {
+	word = strings.ToLower(word)
+	for _, ending := range frenchEndings {
+		if strings.HasSuffix(word, ending) {
+			word = strings.TrimSuffix(word, ending) + "ez"
+			break
+		}
+	}
+	word = strings.ToLower(frenchCedilla.Replace(letters(word)))
+	if len(word) == 0 {
+		return nil
+	}
+
+	/* The final E is silent, as well as most final consonants, such as the
+	   two ending "vingt", and the R of the infinitives */
+	if len(word) > 2 {
+		word = strings.TrimSuffix(strings.TrimSuffix(word, "s"), "e")
+	}
+	for len(word) > 1 && strings.IndexByte(frenchSilent, word[len(word)-1]) >= 0 {
+		word = word[:len(word)-1]
+	}
+	if len(word) > 4 && strings.HasSuffix(word, "er") {
+		word = word[:len(word)-1]
+	}
+
+	var code strings.Builder
+	for i := 0; i < len(word); {
+		sound, length := frenchLetters[word[i]-'a'], 1
+		for _, rule := range frenchRules[word[i]] {
+			end := i + len(rule.letters)
+			if strings.HasPrefix(word[i:], rule.letters) && (rule.when == nil || rule.when(word, i, end)) {
+				sound, length = rule.sound, len(rule.letters)
+				break
+			}
+		}
+		// Doubled letters sound like a single one
+		for _, r := range sound {
+			if code.Len() == 0 || code.String()[code.Len()-1] != byte(r) {
+				code.WriteRune(r)
+			}
+		}
+		i += length
+	}
+	if code.Len() == 0 {
+		return nil
+	}
+	return []string{code.String()}
+}
@@ -0,0 +1,45 @@
+package phonetic
+
+import (
+	"testing"
+)
+
+func TestFrench(t *testing.T) {
+	var soundAlike = [][]string{
+		{"physique", "fizzik", "Physiques"},
+		{"photo", "foto"},
+		{"chapeau", "chapo", "chapeaux"},
+		{"oiseau", "oizo"},
+		{"garçon", "garson"},
+		{"pharmacie", "farmassi"},
+		{"vingt", "vin", "vain", "vint"},
+		{"temps", "tant", "tan"},
+		{"quatre", "katre"},
+		{"parler", "parlé", "parlez", "parlait", "parlées"},
+		{"travail", "travaille"},
+		{"guerre", "guère"},
+		{"cinq", "saink"},
+		{"nation", "nassion"},
+	}
+	for _, words := range soundAlike {
+		expected := French{}.Encode(words[0])
+		for _, word := range words[1:] {
+			if codes := (French{}).Encode(word); len(codes) != 1 || codes[0] != expected[0] {
+				t.Error(word, "encoded as", codes, ", should sound like", words[0], "encoded as", expected)
+			}
+		}
+	}
+
+	testEncoder(t, French{}, []encoderCase{
+		{"physique", []string{"FISIK"}},
+		{"chien", []string{"XI2"}},
+		{"bonne", []string{"BON"}},
+		{"mangeons", []string{"M1J3"}},
+		{"montagne", []string{"M3TANI"}},
+		{"été", []string{"ETE"}},
+		{"œuf", []string{"EF"}},
+		{"Ñandú", []string{"N1DY"}},
+		{"", nil},
+		{"h", nil},
+	})
+}
@@ -0,0 +1,554 @@
+package phonetic
+
+import (
+	"strings"
+)
+
+// DoubleMetaphone is the Double Metaphone of Lawrence Philips. It encodes the
+// consonant sounds of a word, in English and in the many languages which
+// English names come from, and gives a second code when a word has another
+// common pronunciation, such as "XMT" and "SMT" for "Schmidt". The codes use
+// the letters A for a vowel starting the word, F, H, J, K, L, M, N, P, R, S,
+// T, X for "sh" and 0 for "th".
+//
+// Attributes:
+// MaxLength (int): the length the codes are cut at, traditionally 4, or 0 to
+// keep them whole
+type DoubleMetaphone struct {
+	MaxLength int
+}
+
+// Encode returns the primary code of a word, followed by its alternate code
+// if it is a different one
+func (encoder DoubleMetaphone) Encode(word string) []string {
+	value := []rune(letters(word))
+	if len(value) == 0 {
+		return nil
+	}
+	m := metaphone{value: value, maxLength: encoder.MaxLength}
+	m.slavoGermanic = m.containsAnywhere("W") || m.containsAnywhere("K") ||
+		m.containsAnywhere("CZ") || m.containsAnywhere("WITZ")
+	m.encode()
+
+	primary, alternate := m.primary.String(), m.alternate.String()
+	if len(primary) == 0 && len(alternate) == 0 {
+		return nil
+	}
+	if alternate == primary {
+		return []string{primary}
+	}
+	return []string{primary, alternate}
+}
+
+// metaphone holds the state of the encoding of a word
+type metaphone struct {
+	value              []rune
+	maxLength          int
+	slavoGermanic      bool
+	primary, alternate strings.Builder
+}
+
+func (m *metaphone) at(index int) rune {
+	if index < 0 || index >= len(m.value) {
+		return 0
+	}
+	return m.value[index]
+}
+
+// contains tells whether one of the options is found at an index
+func (m *metaphone) contains(index int, options ...string) bool {
+	if index < 0 {
+		return false
+	}
+	for _, option := range options {
+		length := len(option)
+		if index+length > len(m.value) {
+			continue
+		}
+		if string(m.value[index:index+length]) == option {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *metaphone) containsAnywhere(option string) bool {
+	return strings.Contains(string(m.value), option)
+}
+
+func (m *metaphone) isVowel(index int) bool {
+	return strings.ContainsRune("AEIOUY", m.at(index))
+}
+
+func (m *metaphone) last() int {
+	return len(m.value) - 1
+}
+
+func (m *metaphone) complete() bool {
+	return m.maxLength > 0 && m.primary.Len() >= m.maxLength && m.alternate.Len() >= m.maxLength
+}
+
+func appendCode(builder *strings.Builder, code string, maxLength int) {
+	if maxLength > 0 && builder.Len()+len(code) > maxLength {
+		code = code[:max(0, maxLength-builder.Len())]
+	}
+	builder.WriteString(code)
+}
+
+// add appends a code to both the primary and the alternate codes
+func (m *metaphone) add(code string) {
+	m.addBoth(code, code)
+}
+
+func (m *metaphone) addBoth(primary, alternate string) {
+	appendCode(&m.primary, primary, m.maxLength)
+	appendCode(&m.alternate, alternate, m.maxLength)
+}
+
+// skip returns the index following a letter, skipping it when it is doubled
+// by one of the options
+func (m *metaphone) skip(index int, options ...string) int {
+	if m.contains(index+1, options...) {
+		return index + 2
+	}
+	return index + 1
+}
+
+func (m *metaphone) encode() {
+	index := 0
+	// The first letter is silent in these words
+	if m.contains(0, "GN", "KN", "PN", "WR", "PS") {
+		index = 1
+	}
+	for !m.complete() && index < len(m.value) {
+		switch m.value[index] {
+		case 'A', 'E', 'I', 'O', 'U', 'Y':
+			// Vowels are only coded at the beginning of words
+			if index == 0 {
+				m.add("A")
+			}
+			index++
+		case 'B':
+			m.add("P")
+			index = m.skip(index, "B")
+		case 'Ç':
+			m.add("S")
+			index++
+		case 'C':
+			index = m.c(index)
+		case 'D':
+			index = m.d(index)
+		case 'F':
+			m.add("F")
+			index = m.skip(index, "F")
+		case 'G':
+			index = m.g(index)
+		case 'H':
+			// Only coded between vowels, or before one at the beginning
+			if (index == 0 || m.isVowel(index-1)) && m.isVowel(index+1) {
+				m.add("H")
+				index += 2
+			} else {
+				index++
+			}
+		case 'J':
+			index = m.j(index)
+		case 'K':
+			m.add("K")
+			index = m.skip(index, "K")
+		case 'L':
+			index = m.l(index)
+		case 'M':
+			m.add("M")
+			// "dumb", "thumb"
+			if m.at(index+1) == 'M' || m.contains(index-1, "UMB") && (index+1 == m.last() || m.contains(index+2, "ER")) {
+				index += 2
+			} else {
+				index++
+			}
+		case 'N':
+			m.add("N")
+			index = m.skip(index, "N")
+		case 'Ñ':
+			m.add("N")
+			index++
+		case 'P':
+			if m.at(index+1) == 'H' {
+				m.add("F")
+				index += 2
+			} else {
+				m.add("P")
+				index = m.skip(index, "P", "B")
+			}
+		case 'Q':
+			m.add("K")
+			index = m.skip(index, "Q")
+		case 'R':
+			// French "Rogier", where the final R is silent
+			if index == m.last() && !m.slavoGermanic && m.contains(index-2, "IE") && !m.contains(index-4, "ME", "MA") {
+				m.addBoth("", "R")
+			} else {
+				m.add("R")
+			}
+			index = m.skip(index, "R")
+		case 'S':
+			index = m.s(index)
+		case 'T':
+			index = m.t(index)
+		case 'V':
+			m.add("F")
+			index = m.skip(index, "V")
+		case 'W':
+			index = m.w(index)
+		case 'X':
+			// French "breaux", where the final X is silent
+			if index == 0 {
+				m.add("S")
+			} else if !(index == m.last() && (m.contains(index-3, "IAU", "EAU") || m.contains(index-2, "AU", "OU"))) {
+				m.add("KS")
+			}
+			index = m.skip(index, "C", "X")
+		case 'Z':
+			index = m.z(index)
+		default:
+			index++
+		}
+	}
+}
+
+func (m *metaphone) c(index int) int {
+	switch {
+	case m.cAsK(index):
+		m.add("K")
+		return index + 2
+	case index == 0 && m.contains(index, "CAESAR"):
+		m.add("S")
+		return index + 2
+	case m.contains(index, "CH"):
+		return m.ch(index)
+	case m.contains(index, "CZ") && !m.contains(index-2, "WICZ"):
+		// "Czerny"
+		m.addBoth("S", "X")
+		return index + 2
+	case m.contains(index+1, "CIA"):
+		// Italian "focaccia"
+		m.add("X")
+		return index + 3
+	case m.contains(index, "CC") && !(index == 1 && m.at(0) == 'M'):
+		// "bellocchio" but not "bacchus"
+		if m.contains(index+2, "I", "E", "H") && !m.contains(index+2, "HU") {
+			// "accident", "accede", "succeed"
+			if index == 1 && m.at(0) == 'A' || m.contains(index-1, "UCCEE", "UCCES") {
+				m.add("KS")
+			} else {
+				// "bacci", "bertucci"
+				m.add("X")
+			}
+			return index + 3
+		}
+		// Pierce's rule
+		m.add("K")
+		return index + 2
+	case m.contains(index, "CK", "CG", "CQ"):
+		m.add("K")
+		return index + 2
+	case m.contains(index, "CI", "CE", "CY"):
+		// Italian against English
+		if m.contains(index, "CIO", "CIE", "CIA") {
+			m.addBoth("S", "X")
+		} else {
+			m.add("S")
+		}
+		return index + 2
+	}
+	m.add("K")
+	if m.contains(index+1, "C", "K", "Q") && !m.contains(index+1, "CE", "CI") {
+		return index + 2
+	}
+	return index + 1
+}
+
+// cAsK tells whether a C sounds like a K in Germanic words such as "bacher"
+// and "macher", or in "chianti"
+func (m *metaphone) cAsK(index int) bool {
+	if m.contains(index, "CHIA") {
+		return true
+	}
+	if index <= 1 || m.isVowel(index-2) || !m.contains(index-1, "ACH") {
+		return false
+	}
+	next := m.at(index + 2)
+	return next != 'I' && next != 'E' || m.contains(index-2, "BACHER", "MACHER")
+}
+
+func (m *metaphone) ch(index int) int {
+	switch {
+	case index > 0 && m.contains(index, "CHAE"):
+		// "Michael"
+		m.addBoth("K", "X")
+	case index == 0 && (m.contains(index+1, "HARAC", "HARIS") || m.contains(index+1, "HOR", "HYM", "HIA", "HEM")) &&
+		!m.contains(0, "CHORE"):
+		// Greek roots such as "chemistry" and "chorus"
+		m.add("K")
+	case m.contains(0, "VAN ", "VON ", "SCH") || m.contains(index-2, "ORCHES", "ARCHIT", "ORCHID") ||
+		m.contains(index+2, "T", "S") ||
+		(index == 0 || m.contains(index-1, "A", "O", "U", "E")) &&
+			(m.contains(index+2, "L", "R", "N", "M", "B", "H", "F", "V", "W", " ") || index+1 == m.last()):
+		// Germanic and Greek words such as "orchestra" and "achtung"
+		m.add("K")
+	case index > 0:
+		if m.contains(0, "MC") {
+			// "McHugh"
+			m.add("K")
+		} else {
+			m.addBoth("X", "K")
+		}
+	default:
+		m.add("X")
+	}
+	return index + 2
+}
+
+func (m *metaphone) d(index int) int {
+	if m.contains(index, "DG") {
+		if m.contains(index+2, "I", "E", "Y") {
+			// "edge"
+			m.add("J")
+			return index + 3
+		}
+		// "Edgar"
+		m.add("TK")
+		return index + 2
+	}
+	m.add("T")
+	if m.contains(index, "DT", "DD") {
+		return index + 2
+	}
+	return index + 1
+}
+
+func (m *metaphone) g(index int) int {
+	switch {
+	case m.at(index+1) == 'H':
+		return m.gh(index)
+	case m.at(index+1) == 'N':
+		if index == 1 && m.isVowel(0) && !m.slavoGermanic {
+			m.addBoth("KN", "N")
+		} else if !m.contains(index+2, "EY") && m.at(index+1) != 'Y' && !m.slavoGermanic {
+			m.addBoth("N", "KN")
+		} else {
+			m.add("KN")
+		}
+		return index + 2
+	case m.contains(index+1, "LI") && !m.slavoGermanic:
+		// "tagliaro"
+		m.addBoth("KL", "L")
+		return index + 2
+	case index == 0 && (m.at(index+1) == 'Y' ||
+		m.contains(index+1, "ES", "EP", "EB", "EL", "EY", "IB", "IL", "IN", "IE", "EI", "ER")):
+		m.addBoth("K", "J")
+		return index + 2
+	case (m.contains(index+1, "ER") || m.at(index+1) == 'Y') && !m.contains(0, "DANGER", "RANGER", "MANGER") &&
+		!m.contains(index-1, "E", "I") && !m.contains(index-1, "RGY", "OGY"):
+		m.addBoth("K", "J")
+		return index + 2
+	case m.contains(index+1, "E", "I", "Y") || m.contains(index-1, "AGGI", "OGGI"):
+		// Italian "biaggi"
+		if m.contains(0, "VAN ", "VON ", "SCH") || m.contains(index+1, "ET") {
+			m.add("K")
+		} else if m.contains(index+1, "IER") {
+			m.add("J")
+		} else {
+			m.addBoth("J", "K")
+		}
+		return index + 2
+	case m.at(index+1) == 'G':
+		m.add("K")
+		return index + 2
+	}
+	m.add("K")
+	return index + 1
+}
+
+func (m *metaphone) gh(index int) int {
+	switch {
+	case index > 0 && !m.isVowel(index-1):
+		m.add("K")
+	case index == 0:
+		// "ghislane", "ghiradelli"
+		if m.at(index+2) == 'I' {
+			m.add("J")
+		} else {
+			m.add("K")
+		}
+	case index > 1 && m.contains(index-2, "B", "H", "D") || index > 2 && m.contains(index-3, "B", "H", "D") ||
+		index > 3 && m.contains(index-4, "B", "H"):
+		// Silent in "hugh", "bough", "broughton"
+	default:
+		// "laugh", "McLaughlin", "cough", "gough", "rough", "tough"
+		if index > 2 && m.at(index-1) == 'U' && m.contains(index-3, "C", "G", "L", "R", "T") {
+			m.add("F")
+		} else if index > 0 && m.at(index-1) != 'I' {
+			m.add("K")
+		}
+	}
+	return index + 2
+}
+
+func (m *metaphone) j(index int) int {
+	if m.contains(index, "JOSE") || m.contains(0, "SAN ") {
+		// Spanish "Jose", "San Jacinto"
+		if index == 0 && m.at(index+4) == ' ' || len(m.value) == 4 || m.contains(0, "SAN ") {
+			m.add("H")
+		} else {
+			m.addBoth("J", "H")
+		}
+		return index + 1
+	}
+	switch {
+	case index == 0:
+		// "Yankelovich", "Jankelowicz"
+		m.addBoth("J", "A")
+	case m.isVowel(index-1) && !m.slavoGermanic && (m.at(index+1) == 'A' || m.at(index+1) == 'O'):
+		// Spanish pronunciation of "bajador"
+		m.addBoth("J", "H")
+	case index == m.last():
+		m.addBoth("J", "")
+	case !m.contains(index+1, "L", "T", "K", "S", "N", "M", "B", "Z") && !m.contains(index-1, "S", "K", "L"):
+		m.add("J")
+	}
+	return m.skip(index, "J")
+}
+
+func (m *metaphone) l(index int) int {
+	if m.at(index+1) != 'L' {
+		m.add("L")
+		return index + 1
+	}
+	// Spanish "cabrillo", "gallegos", where the double L is silent
+	if index == len(m.value)-3 && m.contains(index-1, "ILLO", "ILLA", "ALLE") ||
+		(m.contains(m.last()-1, "AS", "OS") || m.contains(m.last(), "A", "O")) && m.contains(index-1, "ALLE") {
+		m.addBoth("L", "")
+	} else {
+		m.add("L")
+	}
+	return index + 2
+}
+
+func (m *metaphone) s(index int) int {
+	switch {
+	case m.contains(index-1, "ISL", "YSL"):
+		// Silent in "island", "isle", "carlisle"
+		return index + 1
+	case index == 0 && m.contains(index, "SUGAR"):
+		m.addBoth("X", "S")
+		return index + 1
+	case m.contains(index, "SH"):
+		// Germanic "Holmsheim"
+		if m.contains(index+1, "HEIM", "HOEK", "HOLM", "HOLZ") {
+			m.add("S")
+		} else {
+			m.add("X")
+		}
+		return index + 2
+	case m.contains(index, "SIO", "SIA") || m.contains(index, "SIAN"):
+		// Italian and Armenian
+		if m.slavoGermanic {
+			m.add("S")
+		} else {
+			m.addBoth("S", "X")
+		}
+		return index + 3
+	case index == 0 && m.contains(index+1, "M", "N", "L", "W") || m.contains(index+1, "Z"):
+		// German and anglicisations, "Smith" matches "Schmidt"
+		m.addBoth("S", "X")
+		return m.skip(index, "Z")
+	case m.contains(index, "SC"):
+		return m.sc(index)
+	}
+	// French "resnais", "artois"
+	if index == m.last() && m.contains(index-2, "AI", "OI") {
+		m.addBoth("", "S")
+	} else {
+		m.add("S")
+	}
+	return m.skip(index, "S", "Z")
+}
+
+func (m *metaphone) sc(index int) int {
+	switch {
+	case m.at(index+2) == 'H':
+		if m.contains(index+3, "OO", "ER", "EN", "UY", "ED", "EM") {
+			// Dutch "school", "schooner", German "schenker"
+			if m.contains(index+3, "ER", "EN") {
+				m.addBoth("X", "SK")
+			} else {
+				m.add("SK")
+			}
+		} else if index == 0 && !m.isVowel(3) && m.at(3) != 'W' {
+			m.addBoth("X", "S")
+		} else {
+			m.add("X")
+		}
+	case m.contains(index+2, "I", "E", "Y"):
+		m.add("S")
+	default:
+		m.add("SK")
+	}
+	return index + 3
+}
+
+func (m *metaphone) t(index int) int {
+	switch {
+	case m.contains(index, "TION"), m.contains(index, "TIA", "TCH"):
+		m.add("X")
+		return index + 3
+	case m.contains(index, "TH") || m.contains(index, "TTH"):
+		// "Thomas", "Thames"
+		if m.contains(index+2, "OM", "AM") || m.contains(0, "VAN ", "VON ", "SCH") {
+			m.add("T")
+		} else {
+			m.addBoth("0", "T")
+		}
+		return index + 2
+	}
+	m.add("T")
+	return m.skip(index, "T", "D")
+}
+
+func (m *metaphone) w(index int) int {
+	switch {
+	case m.contains(index, "WR"):
+		m.add("R")
+		return index + 2
+	case index == 0 && (m.isVowel(index+1) || m.contains(index, "WH")):
+		// "Wasserman" against "Vasserman"
+		if m.isVowel(index + 1) {
+			m.addBoth("A", "F")
+		} else {
+			m.add("A")
+		}
+	case index == m.last() && m.isVowel(index-1) || m.contains(index-1, "EWSKI", "EWSKY", "OWSKI", "OWSKY") ||
+		m.contains(0, "SCH"):
+		// Polish "Filipowicz"
+		m.addBoth("", "F")
+	case m.contains(index, "WICZ", "WITZ"):
+		m.addBoth("TS", "FX")
+		return index + 4
+	}
+	return index + 1
+}
+
+func (m *metaphone) z(index int) int {
+	if m.at(index+1) == 'H' {
+		// Chinese "Zhao"
+		m.add("J")
+		return index + 2
+	}
+	if m.contains(index+1, "ZO", "ZI", "ZA") || m.slavoGermanic && index > 0 && m.at(index-1) != 'T' {
+		m.addBoth("S", "TS")
+	} else {
+		m.add("S")
+	}
+	return m.skip(index, "Z")
+}
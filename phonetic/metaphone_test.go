@@ -0,0 +1,37 @@
+package phonetic
+
+import (
+	"testing"
+)
+
+func TestDoubleMetaphone(t *testing.T) {
+	testEncoder(t, DoubleMetaphone{MaxLength: 4}, []encoderCase{
+		{"Smith", []string{"SM0", "XMT"}},
+		{"Schmidt", []string{"XMT", "SMT"}},
+		{"Michael", []string{"MKL", "MXL"}},
+		{"Thomas", []string{"TMS"}},
+		{"Jose", []string{"HS"}},
+		{"Xavier", []string{"SF", "SFR"}},
+		{"physique", []string{"FSK"}},
+		{"knight", []string{"NT"}},
+		{"Thumb", []string{"0M", "TM"}},
+		{"Caesar", []string{"SSR"}},
+		{"chianti", []string{"KNT"}},
+		{"character", []string{"KRKT"}},
+		{"edge", []string{"AJ"}},
+		{"Edgar", []string{"ATKR"}},
+		{"laugh", []string{"LF"}},
+		{"accident", []string{"AKST"}},
+		{"Wasserman", []string{"ASRM", "FSRM"}},
+		{"Filipowicz", []string{"FLPT", "FLPF"}},
+		{"Gallegos", []string{"KLKS", "KKS"}},
+		{"Zhao", []string{"J"}},
+		{"", nil},
+		{"h", nil},
+	})
+
+	// Without a maximum length the codes are kept whole
+	testEncoder(t, DoubleMetaphone{}, []encoderCase{
+		{"Schwarzenegger", []string{"XRSNKR", "XFRTSNKR"}},
+	})
+}
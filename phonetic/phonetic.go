@@ -0,0 +1,96 @@
+package phonetic
+
+import (
+	"strings"
+	"unicode"
+)
+
+/* Phonetic encoders turn words into codes of how they sound, so that words
+   which are spelled far apart but pronounced alike, such as "physique" and
+   "fizzik", get the same code. Every encoder works on single words, Encode
+   applies one to every word of a string. */
+
+// Encoder computes the phonetic codes of a word. Words sounding alike share
+// at least one of their codes.
+type Encoder interface {
+	// Encode returns the codes of a word, the most common pronunciation
+	// first, or nothing if the word has no letter which can be encoded
+	Encode(word string) []string
+}
+
+var encoderNames = map[string]Encoder{
+	"soundex":   Soundex{},
+	"metaphone": DoubleMetaphone{MaxLength: 4},
+	"french":    French{},
+}
+
+// Named returns the encoder of this package with the given name: "soundex",
+// "metaphone" for the Double Metaphone or "french".
+//
+// Arguments:
+// name (string): the name of the encoder
+//
+// Returns: (Encoder, bool) the encoder and whether the name is known
+func Named(name string) (Encoder, bool) {
+	encoder, present := encoderNames[name]
+	return encoder, present
+}
+
+// Encode computes the phonetic codes of a string of one or more words, which
+// are the codes of its words separated by spaces. Encoders giving several
+// codes for a word give a second code made of the last code of every word.
+//
+// Arguments:
+// encoder (Encoder): the encoder of the words
+// s (string): the string to encode
+//
+// Returns: ([]string) the codes of the string, at most two of them
+func Encode(encoder Encoder, s string) []string {
+	words := strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	var primary, alternate []string
+	for _, word := range words {
+		codes := encoder.Encode(word)
+		if len(codes) == 0 {
+			continue
+		}
+		primary = append(primary, codes[0])
+		alternate = append(alternate, codes[len(codes)-1])
+	}
+	if len(primary) == 0 {
+		return nil
+	}
+	codes := []string{strings.Join(primary, " ")}
+	if last := strings.Join(alternate, " "); last != codes[0] {
+		codes = append(codes, last)
+	}
+	return codes
+}
+
+// folds spells the accented Latin letters without their accents. The cedilla
+// and the tilde of Ç and Ñ change how they sound, so they are kept.
+var folds = map[rune]string{
+	'À': "A", 'Á': "A", 'Â': "A", 'Ã': "A", 'Ä': "A", 'Å': "A", 'Æ': "AE",
+	'È': "E", 'É': "E", 'Ê': "E", 'Ë': "E",
+	'Ì': "I", 'Í': "I", 'Î': "I", 'Ï': "I",
+	'Ò': "O", 'Ó': "O", 'Ô': "O", 'Õ': "O", 'Ö': "O", 'Ø': "O", 'Œ': "OE",
+	'Ù': "U", 'Ú': "U", 'Û': "U", 'Ü': "U",
+	'Ý': "Y", 'Ÿ': "Y", 'ß': "SS",
+}
+
+// letters returns the letters of a word in upper case and without their
+// accents, dropping every other rune
+func letters(word string) string {
+	var builder strings.Builder
+	builder.Grow(len(word))
+	for _, r := range word {
+		r = unicode.ToUpper(r)
+		if fold, present := folds[r]; present {
+			builder.WriteString(fold)
+		} else if r < unicode.MaxASCII && unicode.IsLetter(r) || r == 'Ç' || r == 'Ñ' {
+			builder.WriteRune(r)
+		}
+	}
+	return builder.String()
+}
@@ -0,0 +1,51 @@
+package phonetic
+
+import (
+	"reflect"
+	"testing"
+)
+
+// encoderCase is a word along with the codes an encoder should give it
+type encoderCase struct {
+	word  string
+	codes []string
+}
+
+func testEncoder(t *testing.T, encoder Encoder, testCases []encoderCase) {
+	for _, testCase := range testCases {
+		if codes := encoder.Encode(testCase.word); !reflect.DeepEqual(codes, testCase.codes) {
+			t.Error(testCase.word, "encoded as", codes, ", should be", testCase.codes)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	var testCases = []struct {
+		encoder Encoder
+		input   string
+		codes   []string
+	}{
+		{Soundex{}, "Robert Smith", []string{"R163 S530"}},
+		{DoubleMetaphone{MaxLength: 4}, "Michael Smith", []string{"MKL SM0", "MXL XMT"}},
+		{DoubleMetaphone{MaxLength: 4}, "Thomas Smith", []string{"TMS SM0", "TMS XMT"}},
+		{French{}, "  la physique-quantique ", []string{"LA FISIK K1TIK"}},
+		{French{}, "42 !", nil},
+		{French{}, "", nil},
+	}
+	for _, testCase := range testCases {
+		if codes := Encode(testCase.encoder, testCase.input); !reflect.DeepEqual(codes, testCase.codes) {
+			t.Error(testCase.input, "encoded as", codes, ", should be", testCase.codes)
+		}
+	}
+}
+
+func TestNamed(t *testing.T) {
+	for name, expected := range map[string]Encoder{"soundex": Soundex{}, "metaphone": DoubleMetaphone{4}, "french": French{}} {
+		if encoder, present := Named(name); !present || encoder != expected {
+			t.Error("Wrong encoder named", name, ":", encoder)
+		}
+	}
+	if _, present := Named("nysiis"); present {
+		t.Error("Unknown encoders should not be found")
+	}
+}
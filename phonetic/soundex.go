@@ -0,0 +1,55 @@
+package phonetic
+
+// Soundex is the American Soundex, which keeps the first letter of a word
+// followed by three digits standing for its next consonants, such as "R163"
+// for both "Robert" and "Rupert". It suits English names.
+type Soundex struct{}
+
+// soundexDigits holds the digit of every letter, 0 for the vowels and for H
+// and W, which are dropped
+var soundexDigits = [26]byte{
+	'0', '1', '2', '3', '0', '1', '2', '0', '0', '2', '2', '4', '5',
+	'5', '0', '1', '2', '6', '2', '3', '0', '1', '0', '2', '0', '2',
+}
+
+func soundexDigit(r rune) byte {
+	switch r {
+	case 'Ç':
+		r = 'C'
+	case 'Ñ':
+		r = 'N'
+	}
+	return soundexDigits[r-'A']
+}
+
+// Encode returns the Soundex code of a word
+func (Soundex) Encode(word string) []string {
+	runes := []rune(letters(word))
+	if len(runes) == 0 {
+		return nil
+	}
+	code := []byte{byte(runes[0]), '0', '0', '0'}
+	switch runes[0] {
+	case 'Ç':
+		code[0] = 'C'
+	case 'Ñ':
+		code[0] = 'N'
+	}
+	length, previous := 1, soundexDigit(runes[0])
+	for _, r := range runes[1:] {
+		if length == len(code) {
+			break
+		}
+		digit := soundexDigit(r)
+		if digit != '0' && digit != previous {
+			code[length] = digit
+			length++
+		}
+		// Consonants with the same digit are only coded once, unless a vowel
+		// separates them. H and W do not separate them.
+		if r != 'H' && r != 'W' {
+			previous = digit
+		}
+	}
+	return []string{string(code)}
+}
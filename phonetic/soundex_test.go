@@ -0,0 +1,24 @@
+package phonetic
+
+import (
+	"testing"
+)
+
+func TestSoundex(t *testing.T) {
+	testEncoder(t, Soundex{}, []encoderCase{
+		{"Robert", []string{"R163"}},
+		{"Rupert", []string{"R163"}},
+		{"Rubin", []string{"R150"}},
+		// Letters with the same digit separated by H or W are coded once
+		{"Ashcraft", []string{"A261"}},
+		{"Tymczak", []string{"T522"}},
+		{"Pfister", []string{"P236"}},
+		{"Honeyman", []string{"H555"}},
+		{"lee", []string{"L000"}},
+		{"Ñandú", []string{"N530"}},
+		{"Çelik", []string{"C420"}},
+		{"O'Hara", []string{"O600"}},
+		{"", nil},
+		{"1984", nil},
+	})
+}
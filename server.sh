@@ -21,6 +21,10 @@ case "$1" in
   stop)
         echo -n "Stopping daemon: "$NAME "\n"
         pkill $NAME
+        # The daemon drains its requests and saves its stores before exiting
+        while pgrep -x $NAME > /dev/null; do
+            sleep 1
+        done
 	;;
 
   *)
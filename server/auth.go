@@ -0,0 +1,202 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+)
+
+/* Clients authenticate with an API key, sent either as a bearer token in the
+   Authorization header or in the X-API-Key header. Every key is granted a
+   permission on some stores, the "*" store standing for every store which is
+   not listed explicitly:
+
+   {
+       "keys": [
+           {"name": "search", "key": "...", "stores": {"products": "read"}},
+           {"name": "indexer", "key": "...", "stores": {"products": "write"}},
+           {"name": "operations", "key": "...", "stores": {"*": "admin"}}
+       ]
+   }
+
+   Reading lets a client query and list keys, writing lets it set and delete
+   keys, and administering lets it create, drop and snapshot whole stores.
+   Every permission includes the ones before it. Requests are not
+   authenticated when no keys are configured. */
+
+// permission is what an API key may do with a store
+type permission int
+
+const (
+	noPermission permission = iota
+	readPermission
+	writePermission
+	adminPermission
+)
+
+// allStores is the store name granting a permission on every store
+const allStores = "*"
+
+var permissionNames = []string{"none", "read", "write", "admin"}
+
+func (p permission) String() string {
+	return permissionNames[p]
+}
+
+func parsePermission(name string) (permission, bool) {
+	for p, permissionName := range permissionNames {
+		if p != int(noPermission) && name == permissionName {
+			return permission(p), true
+		}
+	}
+	return noPermission, false
+}
+
+// apiKey is a configured key, identified by its name in the logs so that the
+// key itself is never written anywhere
+type apiKey struct {
+	name   string
+	stores map[string]permission
+}
+
+// allows tells whether the key has at least the required permission on a
+// store. The nil key of a server without authentication allows everything.
+func (key *apiKey) allows(store string, required permission) bool {
+	if key == nil {
+		return true
+	}
+	granted, present := key.stores[store]
+	if !present {
+		granted = key.stores[allStores]
+	}
+	return granted >= required
+}
+
+// keyDigest is how keys are indexed, so that looking a key up does not
+// compare it with the configured ones byte after byte
+func keyDigest(key string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(key))
+}
+
+// LoadAPIKeys reads the API keys which clients must authenticate with. It
+// must be called before the server handles any request.
+//
+// Arguments:
+// path (string): the JSON file listing the keys and their permissions
+//
+// Returns: (error) the error encountered while reading the file, or the first
+// key which is not valid
+func LoadAPIKeys(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var file struct {
+		Keys []struct {
+			Name   string            `json:"name"`
+			Key    string            `json:"key"`
+			Stores map[string]string `json:"stores"`
+		} `json:"keys"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&file); err != nil {
+		return fmt.Errorf("invalid API keys file %s: %v", path, err)
+	}
+	if len(file.Keys) == 0 {
+		return fmt.Errorf("invalid API keys file %s: no key is configured", path)
+	}
+
+	keys := make(map[[sha256.Size]byte]*apiKey, len(file.Keys))
+	for i, configured := range file.Keys {
+		if len(configured.Name) == 0 {
+			return fmt.Errorf("invalid API key #%d: it has no name", i+1)
+		}
+		if len(configured.Key) == 0 {
+			return fmt.Errorf("invalid API key %s: the key is empty", configured.Name)
+		}
+		digest := keyDigest(configured.Key)
+		if _, present := keys[digest]; present {
+			return fmt.Errorf("invalid API key %s: the key is given more than once", configured.Name)
+		}
+		key := &apiKey{configured.Name, make(map[string]permission, len(configured.Stores))}
+		for store, name := range configured.Stores {
+			p, valid := parsePermission(name)
+			if !valid {
+				return fmt.Errorf("invalid API key %s: %q is not one of read, write or admin", configured.Name, name)
+			}
+			key.stores[store] = p
+		}
+		keys[digest] = key
+	}
+	fuzzyStore.apiKeys = keys
+	return nil
+}
+
+var errNoAPIKey = errors.New("no API key")
+var errUnknownAPIKey = errors.New("unknown API key")
+
+// requestKey finds the key a request was sent with
+func requestKey(r *http.Request) (*apiKey, error) {
+	sent := r.Header.Get("X-API-Key")
+	if authorization := r.Header.Get("Authorization"); len(sent) == 0 && len(authorization) != 0 {
+		scheme, token, _ := strings.Cut(authorization, " ")
+		if strings.EqualFold(scheme, "Bearer") {
+			sent = strings.TrimSpace(token)
+		}
+	}
+	if len(sent) == 0 {
+		return nil, errNoAPIKey
+	}
+	key, present := fuzzyStore.apiKeys[keyDigest(sent)]
+	if !present {
+		return nil, errUnknownAPIKey
+	}
+	return key, nil
+}
+
+// authenticated finds the key of a request. It answers with an error and
+// returns false if the server requires a key which was not sent or is not
+// known. The key is nil when the server does not authenticate requests.
+func authenticated(w http.ResponseWriter, r *http.Request) (*apiKey, bool) {
+	if fuzzyStore.apiKeys == nil {
+		return nil, true
+	}
+	key, err := requestKey(r)
+	if err != nil {
+		slog.Warn("Denied request", "reason", err.Error(),
+			"method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr)
+		w.Header().Set("WWW-Authenticate", `Bearer realm="fuzzyguy"`)
+		writeError(w, http.StatusUnauthorized, apiError{codeUnauthorized, "", "Please provide a valid API key"})
+		return nil, false
+	}
+	return key, true
+}
+
+// authorize checks that a request was sent with a key having at least the
+// required permission on a store, or on every store if the name is
+// allStores. It answers with an error and returns false otherwise.
+func authorize(w http.ResponseWriter, r *http.Request, store string, required permission) bool {
+	key, valid := authenticated(w, r)
+	if !valid {
+		return false
+	}
+	if !key.allows(store, required) {
+		slog.Warn("Denied request", "reason", "missing permission", "key", key.name, "store", store,
+			"required", required.String(), "method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr)
+		scope := "this store"
+		if store == allStores {
+			scope = "every store"
+		}
+		writeError(w, http.StatusForbidden, apiError{codeForbidden, "",
+			fmt.Sprintf("This API key does not have the %s permission on %s", required, scope)})
+		return false
+	}
+	return true
+}
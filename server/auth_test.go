@@ -0,0 +1,115 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func loadTestKeys(t *testing.T, content string) error {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fuzzyStore.apiKeys = nil })
+	return LoadAPIKeys(path)
+}
+
+func request(handler http.HandlerFunc, method, key string, parameters url.Values) int {
+	r := httptest.NewRequest(method, "/fuzzy?"+parameters.Encode(), nil)
+	if len(key) != 0 {
+		r.Header.Set("Authorization", "Bearer "+key)
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w.Code
+}
+
+func TestAPIKeys(t *testing.T) {
+	err := loadTestKeys(t, `{"keys": [
+		{"name": "reader", "key": "r3ad", "stores": {"auth": "read"}},
+		{"name": "writer", "key": "wr1te", "stores": {"auth": "write", "*": "read"}},
+		{"name": "admin", "key": "adm1n", "stores": {"*": "admin"}}
+	]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dropStore("auth") })
+
+	store := url.Values{"store": {"auth"}}
+	key := url.Values{"store": {"auth"}, "key": {"a"}, "value": {"b"}, "distance": {"0"}}
+	batch := url.Values{"store": {"auth"}, "dictionary": {`{"c": "d"}`}}
+	for _, test := range []struct {
+		description string
+		handler     http.HandlerFunc
+		method      string
+		key         string
+		parameters  url.Values
+		status      int
+	}{
+		{"no key", FuzzyHandler, "GET", "", key, http.StatusUnauthorized},
+		{"unknown key", FuzzyHandler, "GET", "wrong", key, http.StatusUnauthorized},
+		{"creating with write", FuzzyHandler, "POST", "wr1te", store, http.StatusForbidden},
+		{"creating with admin", FuzzyHandler, "POST", "adm1n", store, http.StatusCreated},
+		{"setting with read", FuzzyHandler, "PUT", "r3ad", key, http.StatusForbidden},
+		{"setting with write", FuzzyHandler, "PUT", "wr1te", key, http.StatusOK},
+		{"getting with read", FuzzyHandler, "GET", "r3ad", key, http.StatusOK},
+		{"batch setting with read", BatchHandler, "PUT", "r3ad", batch, http.StatusForbidden},
+		{"batch setting with write", BatchHandler, "PUT", "wr1te", batch, http.StatusOK},
+		{"deleting a key with write", FuzzyHandler, "DELETE", "wr1te", key, http.StatusOK},
+		{"dropping with write", FuzzyHandler, "DELETE", "wr1te", store, http.StatusForbidden},
+		{"dropping with admin", FuzzyHandler, "DELETE", "adm1n", store, http.StatusOK},
+	} {
+		if status := request(test.handler, test.method, test.key, test.parameters); status != test.status {
+			t.Errorf("%s: expected status %d, got %d", test.description, test.status, status)
+		}
+	}
+}
+
+func TestAPIKeysListing(t *testing.T) {
+	err := loadTestKeys(t, `{"keys": [{"name": "reader", "key": "r3ad", "stores": {"listed": "read"}}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"listed", "hidden"} {
+		if err = createStore(name, storeConfig{}); err != nil {
+			t.Fatal(err)
+		}
+		defer dropStore(name)
+	}
+
+	r := httptest.NewRequest("GET", "/v1/stores", nil)
+	r.Header.Set("X-API-Key", "r3ad")
+	w := httptest.NewRecorder()
+	V1Handler(w, r)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"listed"`) || strings.Contains(w.Body.String(), `"hidden"`) {
+		t.Error("Listing should only describe the readable stores, got", w.Code, w.Body.String())
+	}
+
+	r = httptest.NewRequest("GET", "/v1/stores/hidden/keys", nil)
+	r.Header.Set("X-API-Key", "r3ad")
+	w = httptest.NewRecorder()
+	V1Handler(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Error("Scanning an unreadable store should be forbidden, got", w.Code)
+	}
+}
+
+func TestLoadAPIKeys(t *testing.T) {
+	for _, content := range []string{
+		`{"keys": []}`,
+		`{"keys": [{"key": "k", "stores": {"*": "read"}}]}`,
+		`{"keys": [{"name": "a", "stores": {"*": "read"}}]}`,
+		`{"keys": [{"name": "a", "key": "k", "stores": {"*": "everything"}}]}`,
+		`{"keys": [{"name": "a", "key": "k"}, {"name": "b", "key": "k"}]}`,
+		`{"keys": [{"name": "a", "key": "k", "permissions": "read"}]}`,
+	} {
+		if err := loadTestKeys(t, content); err == nil {
+			t.Error("Invalid API keys were accepted:", content)
+		}
+	}
+}
@@ -2,11 +2,15 @@ package server
 
 import (
 	"../fuzzy"
+	"../wal"
+	"crypto/sha256"
 	"sync"
+	"time"
 )
 
 type storeStatistics struct {
 	Queries map[string]int
+	Created time.Time
 }
 
 type statistics struct {
@@ -15,14 +19,26 @@ type statistics struct {
 }
 
 type server struct {
-	stores     map[string]*fuzzy.Service
-	stats      map[string]storeStatistics
-	StatsLock  sync.RWMutex
-	StoresLock sync.RWMutex
+	stores        map[string]*fuzzy.Service
+	stats         map[string]storeStatistics
+	configs       map[string]storeConfig
+	journals      map[string]*journal
+	closed        bool // Set by Close, guarded by JournalsLock
+	StatsLock     sync.RWMutex
+	StoresLock    sync.RWMutex
+	JournalsLock  sync.RWMutex
+	dataDir       string
+	journalPolicy *wal.SyncPolicy
+	limits        Limits
+	apiKeys       map[[sha256.Size]byte]*apiKey
 }
 
 var fuzzyStore = server{
-	stores:     make(map[string]*fuzzy.Service),
-	stats:      make(map[string]storeStatistics),
-	StatsLock:  sync.RWMutex{},
-	StoresLock: sync.RWMutex{}}
+	stores:       make(map[string]*fuzzy.Service),
+	stats:        make(map[string]storeStatistics),
+	configs:      make(map[string]storeConfig),
+	journals:     make(map[string]*journal),
+	limits:       DefaultLimits,
+	StatsLock:    sync.RWMutex{},
+	StoresLock:   sync.RWMutex{},
+	JournalsLock: sync.RWMutex{}}
@@ -1,62 +1,100 @@
 package server
 
 import (
+	"../fuzzy"
+	"../wal"
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"strconv"
 )
 
 func getKeyBatchHandler(w http.ResponseWriter, r *http.Request) {
-	parameters, valid := requireParameters([]string{"store", "keys", "distance"}, w, r)
+	parameters, valid := requireParameters([]string{"store", "keys"}, w, r)
 	if !valid {
 		return
 	}
+	if !authorize(w, r, parameters["store"], readPermission) {
+		return
+	}
 
 	store, present := getStore(parameters["store"])
 	if !present {
-		parameterError(w, "store")
+		storeNotFoundError(w)
 		return
 	}
 
-	/* We always require a distance parameter in order to make every request more explicit
-	   about whether we would like to perform and exact match or an approximate one */
-
-	distance, err := strconv.Atoi(parameters["distance"])
+	/* We unmarshall the list of keys */
+	var keys []string
+	err := json.Unmarshal([]byte(parameters["keys"]), &keys)
 	if err != nil {
-		parameterError(w, "distance (numeric)")
+		parameterError(w, "keys", "JSON")
 		return
 	}
 
-	/* We unmarshall the list of keys */
-	var keys []string
-	err = json.Unmarshal([]byte(parameters["keys"]), &keys)
-	if err != nil {
-		parameterError(w, "keys (JSON)")
+	/* In verbose mode every key gets the list of matches holding values
+	   and distances instead of a JSON encoded list of keys */
+	verbose, valid := optionalBool("verbose", r)
+	if !valid {
+		parameterError(w, "verbose", "boolean")
+		return
+	}
+	metric, valid := optionalMetric(r)
+	if !valid {
+		parameterError(w, "metric", "levenshtein, damerau or jarowinkler")
+		return
+	}
+
+	/* We always require a distance parameter in order to make every request more explicit
+	   about whether we would like to perform and exact match or an approximate one, but
+	   for the similarity metrics which are never exact */
+	distance, valid := metricDistance(w, r, metric)
+	if !valid {
+		return
+	}
+	similarity, valid := optionalSimilarity(w, r)
+	if !valid {
+		return
+	}
+	tokens, valid := optionalTokens(w, r, metric)
+	if !valid {
+		return
+	}
+	query := func(key string, results int) []fuzzy.Match {
+		return approximateQuery(store, key, metric, distance, similarity, tokens, results)
+	}
+	exact := distance == 0 && !tokens && metric != fuzzy.JaroWinkler
+	if verbose {
+		getKeyBatchVerbose(w, r, store, parameters["store"], keys, query, exact)
 		return
 	}
 
 	result := make([]string, len(keys))
 
-	/* We treat exact matching here */
-	if distance == 0 {
+	/* We treat exact matching here, keys of multimap stores give the JSON
+	   encoded list of their values just like single queries do */
+	if exact {
 		for i, key := range keys {
-			value, present := store.Get(key)
-			if present {
-				result[i] = value
+			values, present := store.GetAll(key)
+			if !present {
+				continue
+			}
+			if store.Multimap() {
+				jsonResponse, _ := json.Marshal(values)
+				result[i] = string(jsonResponse)
+			} else {
+				result[i] = values[0]
 			}
 		}
 		incrementStats(parameters["store"], "/fuzzy/batch GET")
 		jsonResponse, _ := json.Marshal(result)
 		w.Header().Set("Content-Type", "application/json")
-		fmt.Fprintf(w, string(jsonResponse))
+		fmt.Fprint(w, string(jsonResponse))
 		return
 	}
 
 	/* Approximate matching here */
-	results, err := strconv.Atoi(r.FormValue("results"))
-	if err != nil {
-		parameterError(w, "results")
+	results, valid := optionalResults(w, r)
+	if !valid {
 		return
 	}
 
@@ -67,7 +105,7 @@ func getKeyBatchHandler(w http.ResponseWriter, r *http.Request) {
 
 	for i, key := range keys {
 		go func(k string, j int) {
-			fuzzyResults := store.Query(k, distance, results)
+			fuzzyResults := matchedKeys(query(k, results))
 			jsonResponse, _ := json.Marshal(fuzzyResults)
 			c <- struct {
 				string
@@ -85,7 +123,49 @@ func getKeyBatchHandler(w http.ResponseWriter, r *http.Request) {
 	incrementStats(parameters["store"], "/fuzzy/batch GET")
 	jsonResponse, _ := json.Marshal(result)
 	w.Header().Set("Content-Type", "application/json")
-	fmt.Fprintf(w, string(jsonResponse))
+	fmt.Fprint(w, string(jsonResponse))
+}
+
+func getKeyBatchVerbose(w http.ResponseWriter, r *http.Request, store *fuzzy.Service, name string, keys []string, query func(key string, results int) []fuzzy.Match, exact bool) {
+	result := make([][]fuzzy.Match, len(keys))
+
+	/* We treat exact matching here */
+	if exact {
+		for i, key := range keys {
+			result[i] = []fuzzy.Match{}
+			values, present := store.GetAll(key)
+			if present {
+				result[i] = append(result[i], exactMatch(store, key, values))
+			}
+		}
+		incrementStats(name, "/fuzzy/batch GET")
+		jsonResponse, _ := json.Marshal(result)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, string(jsonResponse))
+		return
+	}
+
+	/* Approximate matching here */
+	results, valid := optionalResults(w, r)
+	if !valid {
+		return
+	}
+
+	done := make(chan bool)
+	for i, key := range keys {
+		go func(k string, j int) {
+			result[j] = query(k, results)
+			done <- true
+		}(key, i)
+	}
+	for steps := 0; steps < len(keys); steps++ {
+		<-done
+	}
+
+	incrementStats(name, "/fuzzy/batch GET")
+	jsonResponse, _ := json.Marshal(result)
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, string(jsonResponse))
 }
 
 func addBatchKeyValueHandler(w http.ResponseWriter, r *http.Request) {
@@ -93,30 +173,48 @@ func addBatchKeyValueHandler(w http.ResponseWriter, r *http.Request) {
 	if !valid {
 		return
 	}
+	if !authorize(w, r, parameters["store"], writePermission) {
+		return
+	}
 
 	store, present := getStore(parameters["store"])
 	if !present {
-		parameterError(w, "store (existent)")
+		storeNotFoundError(w)
 		return
 	}
 
 	dict := make(map[string]string)
 	err := json.Unmarshal([]byte(parameters["dictionary"]), &dict)
 	if err != nil {
-		parameterError(w, "dictionary (JSON)")
+		parameterError(w, "dictionary", "JSON")
 		return
 	}
 
+	records := make([]wal.Record, 0, len(dict))
 	for key, value := range dict {
-		store.Set(key, value)
+		records = append(records, wal.Record{Operation: wal.Set, Key: key, Value: value})
+	}
+	err = journaled(parameters["store"], func() {
+		for _, record := range records {
+			store.Set(record.Key, record.Value)
+		}
+	}, records...)
+	if err != nil {
+		internalError(w, "Could not record the changes")
+		return
 	}
 	incrementStats(parameters["store"], "/fuzzy/batch PUT")
 	fmt.Fprintf(w, "Successfully set the keys")
 }
 
 // BatchHandler handles all requests regardin the described API to process
-// multiple keys and values at once in order to reduce latency.
+// multiple keys and values at once in order to reduce latency. Parameters
+// may be sent as form values or as the fields of an application/json body.
 func BatchHandler(w http.ResponseWriter, r *http.Request) {
+	if err := parseJSONBody(w, r); err != nil {
+		bodyError(w)
+		return
+	}
 	switch r.Method {
 	case "GET":
 		getKeyBatchHandler(w, r)
@@ -125,6 +223,6 @@ func BatchHandler(w http.ResponseWriter, r *http.Request) {
 		addBatchKeyValueHandler(w, r)
 		return
 	default:
-		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		methodNotAllowedError(w)
 	}
 }
@@ -0,0 +1,24 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestBatchMultimap(t *testing.T) {
+	if err := createStore("batchmulti", storeConfig{Multimap: true}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dropStore("batchmulti") })
+	store, _ := getStore("batchmulti")
+	store.Set("ana", "super")
+	store.Set("ana", "duper")
+
+	var result []string
+	parameters := url.Values{"store": {"batchmulti"}, "keys": {`["ana", "anna"]`}, "distance": {"0"}}
+	status := serve(t, BatchHandler, "GET", "/fuzzy/batch", parameters, &result)
+	if status != http.StatusOK || len(result) != 2 || result[0] != `["super","duper"]` || result[1] != "" {
+		t.Errorf("Exact batch query on a multimap store answered %d %q", status, result)
+	}
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+func getCompletionsHandler(w http.ResponseWriter, r *http.Request) {
+	parameters, valid := requireParameters([]string{"store", "prefix", "distance"}, w, r)
+	if !valid {
+		return
+	}
+	if !authorize(w, r, parameters["store"], readPermission) {
+		return
+	}
+
+	store, present := getStore(parameters["store"])
+	if !present {
+		storeNotFoundError(w)
+		return
+	}
+
+	distance, valid := parseDistance(w, parameters["distance"])
+	if !valid {
+		return
+	}
+
+	results, valid := optionalResults(w, r)
+	if !valid {
+		return
+	}
+
+	verbose, valid := optionalBool("verbose", r)
+	if !valid {
+		parameterError(w, "verbose", "boolean")
+		return
+	}
+
+	matches := store.PrefixQuery(parameters["prefix"], distance, results)
+	var jsonResponse []byte
+	if verbose {
+		jsonResponse, _ = json.Marshal(matches)
+	} else {
+		jsonResponse, _ = json.Marshal(matchedKeys(matches))
+	}
+	incrementStats(parameters["store"], "/fuzzy/complete GET")
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, string(jsonResponse))
+}
+
+// CompleteHandler handles fuzzy autocomplete requests, returning the keys
+// which start with something close to the given prefix.
+func CompleteHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		getCompletionsHandler(w, r)
+		return
+	default:
+		methodNotAllowedError(w)
+	}
+}
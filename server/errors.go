@@ -0,0 +1,83 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Codes identifying the kind of every error response, so that clients do not
+// have to parse the messages
+const (
+	codeMissingParameter = "missing_parameter"
+	codeInvalidParameter = "invalid_parameter"
+	codeInvalidBody      = "invalid_body"
+	codeStoreNotFound    = "store_not_found"
+	codeStoreExists      = "store_exists"
+	codeKeyNotFound      = "key_not_found"
+	codeNotFound         = "not_found"
+	codeMethodNotAllowed = "method_not_allowed"
+	codeUnauthorized     = "unauthorized"
+	codeForbidden        = "forbidden"
+	codeUnavailable      = "unavailable"
+	codeInternal         = "internal_error"
+)
+
+// apiError is the body of every error response, wrapped in an object under
+// the "error" field. Parameter names the offending request parameter, if any.
+type apiError struct {
+	Code      string `json:"code"`
+	Parameter string `json:"parameter,omitempty"`
+	Message   string `json:"message"`
+}
+
+func writeError(w http.ResponseWriter, status int, err apiError) {
+	jsonResponse, _ := json.Marshal(struct {
+		Error apiError `json:"error"`
+	}{err})
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	fmt.Fprint(w, string(jsonResponse))
+}
+
+// parameterError reports a parameter which is not valid, along with a short
+// description of what is expected, such as "numeric", which may be empty
+func parameterError(w http.ResponseWriter, parameter, expected string) {
+	message := fmt.Sprintf("Please provide a valid %s parameter", parameter)
+	if len(expected) != 0 {
+		message = fmt.Sprintf("Please provide a valid %s (%s) parameter", parameter, expected)
+	}
+	writeError(w, http.StatusBadRequest, apiError{codeInvalidParameter, parameter, message})
+}
+
+func missingParameterError(w http.ResponseWriter, parameter string) {
+	writeError(w, http.StatusBadRequest, apiError{codeMissingParameter, parameter,
+		fmt.Sprintf("Please provide a valid %s parameter", parameter)})
+}
+
+var (
+	errStoreNotFound = apiError{codeStoreNotFound, "store", "This store does not exist"}
+	errStoreExists   = apiError{codeStoreExists, "store", "This store already exists"}
+	errKeyNotFound   = apiError{codeKeyNotFound, "key", "This key does not exist"}
+)
+
+func storeNotFoundError(w http.ResponseWriter) {
+	writeError(w, http.StatusBadRequest, errStoreNotFound)
+}
+
+func keyNotFoundError(w http.ResponseWriter) {
+	writeError(w, http.StatusBadRequest, errKeyNotFound)
+}
+
+func bodyError(w http.ResponseWriter) {
+	writeError(w, http.StatusBadRequest, apiError{codeInvalidBody, "", "The request body is not a valid JSON object"})
+}
+
+func methodNotAllowedError(w http.ResponseWriter) {
+	writeError(w, http.StatusMethodNotAllowed, apiError{codeMethodNotAllowed, "", http.StatusText(http.StatusMethodNotAllowed)})
+}
+
+func internalError(w http.ResponseWriter, message string) {
+	writeError(w, http.StatusInternalServerError, apiError{codeInternal, "", message})
+}
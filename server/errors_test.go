@@ -0,0 +1,75 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestErrorEnvelope(t *testing.T) {
+	if err := createStore("errors", storeConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dropStore("errors") })
+
+	for _, test := range []struct {
+		description string
+		handler     http.HandlerFunc
+		method      string
+		path        string
+		parameters  url.Values
+		status      int
+		expected    apiError
+	}{
+		{"missing parameter", FuzzyHandler, "GET", "/fuzzy", url.Values{"store": {"errors"}}, http.StatusBadRequest,
+			apiError{Code: codeMissingParameter, Parameter: "key"}},
+		{"invalid parameter", FuzzyHandler, "GET", "/fuzzy", url.Values{"store": {"errors"}, "key": {"a"}, "distance": {"x"}}, http.StatusBadRequest,
+			apiError{Code: codeInvalidParameter, Parameter: "distance"}},
+		{"unknown store", FuzzyHandler, "GET", "/fuzzy", url.Values{"store": {"none"}, "key": {"a"}, "distance": {"0"}}, http.StatusBadRequest,
+			apiError{Code: codeStoreNotFound, Parameter: "store"}},
+		{"unknown key", FuzzyHandler, "GET", "/fuzzy", url.Values{"store": {"errors"}, "key": {"a"}, "distance": {"0"}}, http.StatusBadRequest,
+			apiError{Code: codeKeyNotFound, Parameter: "key"}},
+		{"existing store", FuzzyHandler, "POST", "/fuzzy", url.Values{"store": {"errors"}}, http.StatusBadRequest,
+			apiError{Code: codeStoreExists, Parameter: "store"}},
+		{"legacy method", FuzzyHandler, "PATCH", "/fuzzy", nil, http.StatusMethodNotAllowed,
+			apiError{Code: codeMethodNotAllowed}},
+		{"stats method", StatsHandler, "POST", "/fuzzy/stats", nil, http.StatusMethodNotAllowed,
+			apiError{Code: codeMethodNotAllowed}},
+		{"stats of an unknown store", StatsHandler, "GET", "/fuzzy/stats", url.Values{"store": {"none"}}, http.StatusBadRequest,
+			apiError{Code: codeStoreNotFound, Parameter: "store"}},
+		{"unknown resource", V1Handler, "GET", "/v1/other", nil, http.StatusNotFound,
+			apiError{Code: codeNotFound}},
+		{"versioned method", V1Handler, "POST", "/v1/stores/errors/search", nil, http.StatusMethodNotAllowed,
+			apiError{Code: codeMethodNotAllowed}},
+		{"invalid scan limit", V1Handler, "GET", "/v1/stores/errors/keys", url.Values{"limit": {"0"}}, http.StatusBadRequest,
+			apiError{Code: codeInvalidParameter, Parameter: "limit"}},
+	} {
+		r := httptest.NewRequest(test.method, test.path+"?"+test.parameters.Encode(), nil)
+		w := httptest.NewRecorder()
+		test.handler(w, r)
+		checkError(t, test.description, w, test.status, test.expected)
+	}
+
+	r := httptest.NewRequest("PUT", "/v1/stores/errors/keys/a", strings.NewReader("{"))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	V1Handler(w, r)
+	checkError(t, "invalid body", w, http.StatusBadRequest, apiError{Code: codeInvalidBody})
+}
+
+// checkError checks that a response is an error envelope with the expected
+// status, code and parameter
+func checkError(t *testing.T, description string, w *httptest.ResponseRecorder, status int, expected apiError) {
+	var answer struct{ Error apiError }
+	if err := json.Unmarshal(w.Body.Bytes(), &answer); err != nil {
+		t.Errorf("%s: the answer %q is not an error envelope", description, w.Body.String())
+		return
+	}
+	if w.Code != status || w.Header().Get("Content-Type") != "application/json" ||
+		answer.Error.Code != expected.Code || answer.Error.Parameter != expected.Parameter || len(answer.Error.Message) == 0 {
+		t.Errorf("%s: expected %d %+v, got %d %+v", description, status, expected, w.Code, answer.Error)
+	}
+}
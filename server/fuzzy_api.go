@@ -5,53 +5,96 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"strconv"
 )
 
 func getKeyHandler(w http.ResponseWriter, r *http.Request) {
-	parameters, valid := requireParameters([]string{"store", "key", "distance"}, w, r)
+	parameters, valid := requireParameters([]string{"store", "key"}, w, r)
 	if !valid {
 		return
 	}
+	if !authorize(w, r, parameters["store"], readPermission) {
+		return
+	}
 
 	store, present := getStore(parameters["store"])
 	if !present {
-		parameterError(w, "store")
+		storeNotFoundError(w)
+		return
+	}
+
+	/* In verbose mode we answer with matches holding values and distances */
+	verbose, valid := optionalBool("verbose", r)
+	if !valid {
+		parameterError(w, "verbose", "boolean")
+		return
+	}
+
+	metric, valid := optionalMetric(r)
+	if !valid {
+		parameterError(w, "metric", "levenshtein, damerau or jarowinkler")
 		return
 	}
 
 	/* We always require a distance parameter in order to make every request more explicit
-	   about whether we would like to perform and exact match or an approximate one */
+	   about whether we would like to perform and exact match or an approximate one, but
+	   for the similarity metrics which are never exact */
+	distance, valid := metricDistance(w, r, metric)
+	if !valid {
+		return
+	}
 
-	distance, err := strconv.Atoi(parameters["distance"])
-	if err != nil {
-		parameterError(w, "distance (numeric)")
+	/* In tokens mode the words of the key are looked up in any order, even
+	   when they must be spelled exactly */
+	tokens, valid := optionalTokens(w, r, metric)
+	if !valid {
 		return
 	}
 
 	/* We treat exact matching here */
-	if distance == 0 {
-		value, present := store.Get(parameters["key"])
+	if distance == 0 && !tokens && metric != fuzzy.JaroWinkler {
+		values, present := store.GetAll(parameters["key"])
 		if !present {
-			parameterError(w, "key (Existent)")
+			keyNotFoundError(w)
 			return
 		}
 		incrementStats(parameters["store"], "/fuzzy GET")
-		fmt.Fprintf(w, value)
+		if verbose {
+			jsonResponse, _ := json.Marshal([]fuzzy.Match{exactMatch(store, parameters["key"], values)})
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, string(jsonResponse))
+			return
+		}
+		/* Keys of multimap stores may have several values, so we answer
+		   with the JSON encoded list of values */
+		if store.Multimap() {
+			jsonResponse, _ := json.Marshal(values)
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, string(jsonResponse))
+			return
+		}
+		fmt.Fprint(w, values[0])
 		return
 	}
 
 	/* Approximate matching here */
-	results, err := strconv.Atoi(r.FormValue("results"))
-	if err != nil {
-		parameterError(w, "results")
+	results, valid := optionalResults(w, r)
+	if !valid {
+		return
+	}
+	similarity, valid := optionalSimilarity(w, r)
+	if !valid {
 		return
 	}
-	fuzzyResults := store.Query(parameters["key"], distance, results)
-	jsonResponse, _ := json.Marshal(fuzzyResults)
+	matches := approximateQuery(store, parameters["key"], metric, distance, similarity, tokens, results)
+	var jsonResponse []byte
+	if verbose {
+		jsonResponse, _ = json.Marshal(matches)
+	} else {
+		jsonResponse, _ = json.Marshal(matchedKeys(matches))
+	}
 	incrementStats(parameters["store"], "/fuzzy GET")
 	w.Header().Set("Content-Type", "application/json")
-	fmt.Fprintf(w, string(jsonResponse))
+	fmt.Fprint(w, string(jsonResponse))
 
 }
 
@@ -60,18 +103,23 @@ func newStoreHandler(w http.ResponseWriter, r *http.Request) {
 	if !valid {
 		return
 	}
-
-	_, present := getStore(parameters["store"])
-	if present {
-		http.Error(w, "This store already exists", http.StatusBadRequest)
+	if !authorize(w, r, parameters["store"], adminPermission) {
 		return
 	}
 
-	fuzzyStore.stores[parameters["store"]] = fuzzy.NewService()
-
-	fuzzyStore.StatsLock.Lock()
-	fuzzyStore.stats[parameters["store"]] = storeStatistics{make(map[string]int)}
-	fuzzyStore.StatsLock.Unlock()
+	config, valid := storeConfigFrom(w, r)
+	if !valid {
+		return
+	}
+	err := createStore(parameters["store"], config)
+	if err == errDuplicateStore {
+		writeError(w, http.StatusBadRequest, errStoreExists)
+		return
+	}
+	if err != nil {
+		internalError(w, err.Error())
+		return
+	}
 	incrementStats(parameters["store"], "/fuzzy POST")
 
 	w.WriteHeader(http.StatusCreated)
@@ -84,16 +132,20 @@ func addKeyValueHandler(w http.ResponseWriter, r *http.Request) {
 	if !valid {
 		return
 	}
+	if !authorize(w, r, parameters["store"], writePermission) {
+		return
+	}
 
 	store, present := getStore(parameters["store"])
 	if !present {
-		parameterError(w, "store (existent)")
+		storeNotFoundError(w)
 		return
 	}
 
-	fuzzyStore.StoresLock.Lock()
-	store.Set(parameters["key"], parameters["value"])
-	fuzzyStore.StoresLock.Unlock()
+	if err := setKey(parameters["store"], store, parameters["key"], parameters["value"]); err != nil {
+		internalError(w, "Could not record the change")
+		return
+	}
 
 	fmt.Fprintf(w, "Successfully set the key")
 	incrementStats(parameters["store"], "/fuzzy PUT")
@@ -105,38 +157,58 @@ func deleteKeyHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	/* Deleting the entire collection, when there is no key parameter,
+	   requires the admin permission */
+	key := r.FormValue("key")
+	required := writePermission
+	if len(key) == 0 {
+		required = adminPermission
+	}
+	if !authorize(w, r, parameters["store"], required) {
+		return
+	}
+
 	store, present := getStore(parameters["store"])
 	if !present {
-		parameterError(w, "store (existent)")
+		storeNotFoundError(w)
 		return
 	}
-	/* If there is no key parameter delete the entire collection */
-	key := r.FormValue("key")
 	if len(key) == 0 {
-
-		fuzzyStore.StoresLock.Lock()
-		delete(fuzzyStore.stores, parameters["store"])
-		fuzzyStore.StoresLock.Unlock()
-
-		fuzzyStore.StatsLock.Lock()
-		delete(fuzzyStore.stats, parameters["store"])
-		fuzzyStore.StatsLock.Unlock()
-
+		if err := dropStore(parameters["store"]); err != nil {
+			internalError(w, err.Error())
+		}
 		return
 	}
 
-	deleted := store.Delete(parameters["key"])
-	if deleted {
+	/* An optional value parameter deletes a single key/value pair, which is
+	   mostly useful for multimap stores */
+	value := r.FormValue("value")
+	deleted, err := deleteKey(parameters["store"], store, key, value)
+	if err != nil {
+		internalError(w, "Could not record the change")
+		return
+	}
+	if deleted && len(value) != 0 {
+		fmt.Fprintf(w, "Successfully deleted the value")
+		incrementStats(parameters["store"], "/fuzzy DELETE")
+	} else if deleted {
 		fmt.Fprintf(w, "Successfully deleted the key")
 		incrementStats(parameters["store"], "/fuzzy DELETE")
 	} else {
-		http.Error(w, "The key you deleted does not exist", http.StatusBadRequest)
+		keyNotFoundError(w)
 	}
 }
 
 // FuzzyHandler handles all requests which operate on a single key or value.
-// It follows the API described in the project's wiki.
+// It follows the API described in the project's wiki, which is kept for
+// existing clients next to the versioned one served by V1Handler.
+// Parameters may be sent as form values or as the fields of an
+// application/json body.
 func FuzzyHandler(w http.ResponseWriter, r *http.Request) {
+	if err := parseJSONBody(w, r); err != nil {
+		bodyError(w)
+		return
+	}
 	switch r.Method {
 	case "GET":
 		getKeyHandler(w, r)
@@ -151,6 +223,6 @@ func FuzzyHandler(w http.ResponseWriter, r *http.Request) {
 		newStoreHandler(w, r)
 		return
 	default:
-		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		methodNotAllowedError(w)
 	}
 }
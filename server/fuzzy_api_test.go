@@ -0,0 +1,82 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// serve runs a handler on a request for a path, with the parameters in the
+// query string, and decodes its JSON answer into result unless it is nil
+func serve(t *testing.T, handler http.HandlerFunc, method, path string, parameters url.Values, result interface{}) int {
+	r := httptest.NewRequest(method, path+"?"+parameters.Encode(), nil)
+	w := httptest.NewRecorder()
+	handler(w, r)
+	if result != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), result); err != nil {
+			t.Errorf("%s %s: %v in %q", method, path, err, w.Body.String())
+		}
+	}
+	return w.Code
+}
+
+func TestSimilarityQueries(t *testing.T) {
+	if err := createStore("similar", storeConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dropStore("similar") })
+	store, _ := getStore("similar")
+	store.Set("dwayne", "3")
+
+	/* Similarity queries need no distance and are never exact, even when
+	   a distance of 0 is given */
+	for _, parameters := range []url.Values{
+		{"store": {"similar"}, "key": {"dwane"}, "metric": {"jarowinkler"}},
+		{"store": {"similar"}, "key": {"dwane"}, "metric": {"jarowinkler"}, "distance": {"0"}},
+	} {
+		var keys []string
+		if status := serve(t, FuzzyHandler, "GET", "/fuzzy", parameters, &keys); status != http.StatusOK || len(keys) != 1 || keys[0] != "dwayne" {
+			t.Errorf("Similarity query %v answered %d %v", parameters, status, keys)
+		}
+	}
+
+	var keys []string
+	parameters := url.Values{"store": {"similar"}, "key": {"dwane"}, "metric": {"jarowinkler"}, "min_similarity": {"0.99"}}
+	if serve(t, FuzzyHandler, "GET", "/fuzzy", parameters, &keys); len(keys) != 0 {
+		t.Error("Similarity query should leave out the keys below min_similarity, not", keys)
+	}
+	parameters = url.Values{"store": {"similar"}, "key": {"dwane"}}
+	if status := serve(t, FuzzyHandler, "GET", "/fuzzy", parameters, nil); status != http.StatusBadRequest {
+		t.Error("Distance queries should still require a distance, not answer", status)
+	}
+
+	var matches []struct{ Key string }
+	parameters = url.Values{"query": {"dwane"}, "metric": {"jarowinkler"}, "min_similarity": {"0.9"}}
+	if status := serve(t, V1Handler, "GET", "/v1/stores/similar/search", parameters, &matches); status != http.StatusOK || len(matches) != 1 {
+		t.Errorf("Similarity search answered %d %v", status, matches)
+	}
+	parameters["min_similarity"] = []string{"2"}
+	var answer struct{ Error apiError }
+	if serve(t, V1Handler, "GET", "/v1/stores/similar/search", parameters, &answer); answer.Error.Parameter != "min_similarity" {
+		t.Error("Similarity search should reject a min_similarity above 1, not", answer)
+	}
+}
+
+func TestExactValueVerbatim(t *testing.T) {
+	if err := createStore("verbatim", storeConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dropStore("verbatim") })
+	store, _ := getStore("verbatim")
+	store.Set("discount", "50%d off")
+
+	parameters := url.Values{"store": {"verbatim"}, "key": {"discount"}, "distance": {"0"}}
+	r := httptest.NewRequest("GET", "/fuzzy?"+parameters.Encode(), nil)
+	w := httptest.NewRecorder()
+	FuzzyHandler(w, r)
+	if w.Body.String() != "50%d off" {
+		t.Errorf("Exact query should answer the value verbatim, not %q", w.Body.String())
+	}
+}
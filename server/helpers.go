@@ -2,29 +2,189 @@ package server
 
 import (
 	"../fuzzy"
-	"fmt"
+	"encoding/json"
+	"io"
+	"mime"
 	"net/http"
+	"strconv"
+	"unicode/utf8"
 )
 
-func parameterError(w http.ResponseWriter, parameter string) {
-	http.Error(w, fmt.Sprintf("Please provide a valid %s parameter", parameter), http.StatusBadRequest)
-}
-
 func requireParameters(parameters []string, w http.ResponseWriter, r *http.Request) (map[string]string, bool) {
 	result := make(map[string]string)
 	for _, parameter := range parameters {
 		result[parameter] = r.FormValue(parameter)
 		if len(result[parameter]) == 0 {
-			parameterError(w, parameter)
+			missingParameterError(w, parameter)
 			return result, false
 		}
 	}
 	return result, true
 }
 
+// parseJSONBody makes the fields of an application/json request body
+// available through r.FormValue, just like form parameters, which they take
+// precedence over. Strings are kept as they are and any other value becomes
+// its JSON text, so that keys and dictionary may be sent as a JSON array and
+// object instead of as JSON strings.
+func parseJSONBody(w http.ResponseWriter, r *http.Request) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		return nil
+	}
+	if err := r.ParseForm(); err != nil {
+		return err
+	}
+
+	var fields map[string]json.RawMessage
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, fuzzyStore.limits.MaxRequestSize)).Decode(&fields)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for name, raw := range fields {
+		var value string
+		if json.Unmarshal(raw, &value) != nil {
+			if string(raw) == "null" {
+				continue
+			}
+			value = string(raw)
+		}
+		r.Form[name] = append([]string{value}, r.Form[name]...)
+	}
+	return nil
+}
+
+// optionalBool parses a boolean parameter which defaults to false when missing.
+// The second value reports whether the parameter was valid.
+func optionalBool(parameter string, r *http.Request) (bool, bool) {
+	value := r.FormValue(parameter)
+	if len(value) == 0 {
+		return false, true
+	}
+	result, err := strconv.ParseBool(value)
+	return result, err == nil
+}
+
+// optionalMetric parses the metric parameter, which defaults to Levenshtein.
+// The second value reports whether the parameter was valid.
+func optionalMetric(r *http.Request) (fuzzy.Metric, bool) {
+	name := r.FormValue("metric")
+	if len(name) == 0 {
+		return fuzzy.Levenshtein, true
+	}
+	return fuzzy.ParseMetric(name)
+}
+
+// optionalSimilarity parses the min_similarity parameter, the minimum
+// similarity of the results of the similarity metrics and of the tokens mode,
+// which defaults to fuzzy.DefaultMinSimilarity. It answers with an error and
+// returns false if it is not a number between 0 and 1.
+func optionalSimilarity(w http.ResponseWriter, r *http.Request) (float64, bool) {
+	value := r.FormValue("min_similarity")
+	if len(value) == 0 {
+		return fuzzy.DefaultMinSimilarity, true
+	}
+	similarity, err := strconv.ParseFloat(value, 64)
+	if err != nil || !(similarity >= 0 && similarity <= 1) {
+		parameterError(w, "min_similarity", "between 0 and 1")
+		return 0, false
+	}
+	return similarity, true
+}
+
+// metricDistance parses the distance parameter, which every query requires
+// but the similarity queries, since they take a minimum similarity instead.
+// It answers with an error and returns false if it is missing or not valid.
+func metricDistance(w http.ResponseWriter, r *http.Request, metric fuzzy.Metric) (int, bool) {
+	if metric == fuzzy.JaroWinkler {
+		return 0, true
+	}
+	value := r.FormValue("distance")
+	if len(value) == 0 {
+		missingParameterError(w, "distance")
+		return 0, false
+	}
+	return parseDistance(w, value)
+}
+
+// optionalTokens parses the mode parameter, which is "keys" by default to
+// compare queries to whole keys, or "tokens" to compare their words in any
+// order. Words are compared with the Levenshtein distance only. It answers
+// with an error and returns false if the mode is not valid.
+func optionalTokens(w http.ResponseWriter, r *http.Request, metric fuzzy.Metric) (bool, bool) {
+	switch r.FormValue("mode") {
+	case "", "keys":
+		return false, true
+	case "tokens":
+		if metric != fuzzy.Levenshtein {
+			parameterError(w, "metric", "levenshtein in tokens mode")
+			return false, false
+		}
+		return true, true
+	}
+	parameterError(w, "mode", "keys or tokens")
+	return false, false
+}
+
+// approximateQuery queries a store with a metric, within the distance for
+// the edit distances or above the similarity for the similarity metrics. In
+// tokens mode the distance applies to every word and the similarity is the
+// minimum token set ratio.
+func approximateQuery(store *fuzzy.Service, query string, metric fuzzy.Metric, distance int, similarity float64, tokens bool, results int) []fuzzy.Match {
+	if tokens {
+		return store.QueryTokens(query, distance, similarity, results)
+	}
+	if metric == fuzzy.JaroWinkler {
+		return store.QuerySimilarity(query, similarity, results)
+	}
+	return store.QueryMetric(query, metric, distance, results)
+}
+
+// matchedKeys extracts the keys of the matches returned by a fuzzy query
+func matchedKeys(matches []fuzzy.Match) []string {
+	keys := make([]string, len(matches))
+	for i, match := range matches {
+		keys[i] = match.Key
+	}
+	return keys
+}
+
+// exactMatch describes the result of an exact lookup in the same way
+// a fuzzy query describes its results
+func exactMatch(store *fuzzy.Service, key string, values []string) fuzzy.Match {
+	match := fuzzy.Match{Key: key, Value: values[0], Distance: 0, Prefix: utf8.RuneCountInString(key)}
+	if store.Multimap() {
+		match.Values = values
+	}
+	return match
+}
+
 func incrementStats(store, operation string) {
 	fuzzyStore.StatsLock.Lock()
-	fuzzyStore.stats[store].Queries[operation]++
+	// The store may have been dropped since the request found it
+	if stats, present := fuzzyStore.stats[store]; present {
+		stats.Queries[operation]++
+	}
+	fuzzyStore.StatsLock.Unlock()
+}
+
+func registerStore(name string, store *fuzzy.Service, config storeConfig) {
+	fuzzyStore.StoresLock.Lock()
+	addStore(name, store, config)
+	fuzzyStore.StoresLock.Unlock()
+}
+
+// addStore registers a store along with its statistics. The caller must hold
+// the StoresLock.
+func addStore(name string, store *fuzzy.Service, config storeConfig) {
+	fuzzyStore.stores[name] = store
+	fuzzyStore.configs[name] = config
+
+	fuzzyStore.StatsLock.Lock()
+	fuzzyStore.stats[name] = storeStatistics{make(map[string]int), config.Created}
 	fuzzyStore.StatsLock.Unlock()
 }
 
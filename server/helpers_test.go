@@ -0,0 +1,60 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serveJSON runs a handler on a request whose parameters are the fields of a
+// JSON body
+func serveJSON(handler http.HandlerFunc, method, path, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json; charset=utf-8")
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func TestJSONBody(t *testing.T) {
+	if err := createStore("json", storeConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dropStore("json") })
+
+	/* The dictionary may be a JSON object rather than a JSON string */
+	w := serveJSON(BatchHandler, "PUT", "/fuzzy/batch", `{"store": "json", "dictionary": {"ana": "super", "bob": "duper"}}`)
+	store, _ := getStore("json")
+	if w.Code != http.StatusOK || store.Len() != 2 {
+		t.Errorf("Setting a dictionary object answered %d %q", w.Code, w.Body.String())
+	}
+
+	/* Keys may be a JSON array, and any other value is read as its text */
+	var values []string
+	w = serveJSON(BatchHandler, "GET", "/fuzzy/batch", `{"store": "json", "keys": ["ana", "bob"], "distance": 0}`)
+	if err := json.Unmarshal(w.Body.Bytes(), &values); err != nil || len(values) != 2 || values[0] != "super" || values[1] != "duper" {
+		t.Errorf("Getting a key array answered %d %q", w.Code, w.Body.String())
+	}
+
+	/* Fields of the body take precedence over the query string */
+	w = serveJSON(FuzzyHandler, "GET", "/fuzzy?key=bob", `{"store": "json", "key": "ana", "distance": 0}`)
+	if w.Code != http.StatusOK || w.Body.String() != "super" {
+		t.Errorf("Getting a key answered %d %q", w.Code, w.Body.String())
+	}
+
+	for _, test := range []struct {
+		handler http.HandlerFunc
+		method  string
+		path    string
+		body    string
+	}{
+		{FuzzyHandler, "PUT", "/fuzzy", `{"store": "json", "key": `},
+		{FuzzyHandler, "GET", "/fuzzy", `["json"]`},
+		{BatchHandler, "PUT", "/fuzzy/batch", `{"store": "json", "dictionary": {"ana"}}`},
+	} {
+		checkError(t, "malformed body "+test.body, serveJSON(test.handler, test.method, test.path, test.body),
+			http.StatusBadRequest, apiError{Code: codeInvalidBody})
+	}
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"../fuzzy"
+	"../wal"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const journalExtension = ".wal"
+
+// journal pairs the write-ahead log of a store with the lock which keeps the
+// order of the logged mutations identical to the order they are applied in.
+type journal struct {
+	log   *wal.Log
+	mutex sync.Mutex
+}
+
+func journalPath(name string) string {
+	return filepath.Join(fuzzyStore.dataDir, url.PathEscape(name)+journalExtension)
+}
+
+func applyRecord(store *fuzzy.Service, record wal.Record) {
+	switch record.Operation {
+	case wal.Set:
+		store.Set(record.Key, record.Value)
+	case wal.Delete:
+		store.Delete(record.Key)
+	case wal.DeleteValue:
+		store.DeleteValue(record.Key, record.Value)
+	}
+}
+
+// openJournal opens the write-ahead log of a store and replays into the
+// store whatever mutations it holds.
+func openJournal(name string, store *fuzzy.Service) error {
+	journalLog, err := wal.Open(journalPath(name), *fuzzyStore.journalPolicy)
+	if err != nil {
+		return err
+	}
+	count, err := journalLog.Replay(func(record wal.Record) {
+		applyRecord(store, record)
+	})
+	if err != nil {
+		journalLog.Close()
+		return fmt.Errorf("could not replay the journal of store %s: %v", name, err)
+	}
+	if count > 0 {
+		slog.Info("Replayed the journal of a store", "store", name, "mutations", count)
+	}
+
+	fuzzyStore.JournalsLock.Lock()
+	fuzzyStore.journals[name] = &journal{log: journalLog}
+	fuzzyStore.JournalsLock.Unlock()
+	return nil
+}
+
+func getJournal(name string) (*journal, bool) {
+	fuzzyStore.JournalsLock.RLock()
+	j, present := fuzzyStore.journals[name]
+	fuzzyStore.JournalsLock.RUnlock()
+	return j, present
+}
+
+// closeJournal closes the write-ahead log of a deleted store and removes it
+func closeJournal(name string) {
+	fuzzyStore.JournalsLock.Lock()
+	j, present := fuzzyStore.journals[name]
+	delete(fuzzyStore.journals, name)
+	fuzzyStore.JournalsLock.Unlock()
+	if !present {
+		return
+	}
+
+	j.mutex.Lock()
+	j.log.Close()
+	if err := os.Remove(journalPath(name)); err != nil && !os.IsNotExist(err) {
+		slog.Warn("Could not remove the journal of a store", "store", name, "error", err)
+	}
+	j.mutex.Unlock()
+}
+
+// journaled records mutations in the write-ahead log of a store, if it has
+// one, before applying them. Nothing is applied if they could not be logged.
+func journaled(name string, apply func(), records ...wal.Record) error {
+	fuzzyStore.JournalsLock.RLock()
+	j, present := fuzzyStore.journals[name]
+	isClosed := fuzzyStore.closed
+	fuzzyStore.JournalsLock.RUnlock()
+	if isClosed {
+		return errClosed
+	}
+	if !present {
+		apply()
+		return nil
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if err := j.log.Append(records...); err != nil {
+		slog.Error("Could not journal mutations", "store", name, "error", err)
+		return err
+	}
+	apply()
+	return nil
+}
+
+// EnableJournals gives every store a write-ahead log in the data directory
+// and replays the mutations already logged there. Stores which only have a
+// log, because they were never saved in a snapshot, are created as well.
+// It must be called after Restore.
+//
+// Arguments:
+// policy (wal.SyncPolicy): when the logs are flushed to stable storage
+//
+// Returns: (error) the first error encountered while opening the logs
+func EnableJournals(policy wal.SyncPolicy) error {
+	if len(fuzzyStore.dataDir) == 0 {
+		return errNoDataDirectory
+	}
+	fuzzyStore.journalPolicy = &policy
+
+	paths, err := filepath.Glob(filepath.Join(fuzzyStore.dataDir, "*"+journalExtension))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		name, err := url.PathUnescape(strings.TrimSuffix(filepath.Base(path), journalExtension))
+		if err != nil {
+			return fmt.Errorf("invalid journal name %s: %v", path, err)
+		}
+		if _, present := getStore(name); !present {
+			config, err := loadStoreConfig(name)
+			if err != nil {
+				return fmt.Errorf("could not load the configuration of store %s: %v", name, err)
+			}
+			store, err := newConfiguredStore(config)
+			if err != nil {
+				return fmt.Errorf("invalid configuration of store %s: %v", name, err)
+			}
+			registerStore(name, store, config)
+		}
+	}
+
+	fuzzyStore.StoresLock.RLock()
+	stores := make(map[string]*fuzzy.Service, len(fuzzyStore.stores))
+	for name, store := range fuzzyStore.stores {
+		stores[name] = store
+	}
+	fuzzyStore.StoresLock.RUnlock()
+
+	for name, store := range stores {
+		if err := openJournal(name, store); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// Limits bounds what a request may ask the server for.
+//
+// Attributes:
+// MaxRequestSize (int64): the maximum size of a request body, in bytes
+// DefaultResults (int): the number of results of a query which does not give
+// the results parameter
+// MaxResults (int): the maximum number of results of a query
+// MaxDistance (int): the maximum distance of a query, unlimited when 0
+type Limits struct {
+	MaxRequestSize int64
+	DefaultResults int
+	MaxResults     int
+	MaxDistance    int
+}
+
+// DefaultLimits are the limits of a server which was not given any
+var DefaultLimits = Limits{MaxRequestSize: 32 << 20, DefaultResults: 10, MaxResults: 1000}
+
+// SetLimits changes the limits of the server. It must be called before the
+// server handles any request.
+//
+// Arguments:
+// limits (Limits): the new limits
+func SetLimits(limits Limits) {
+	fuzzyStore.limits = limits
+}
+
+// parseDistance parses a distance parameter, which may be neither negative
+// nor larger than the configured maximum. It answers with an error and
+// returns false if the distance is not valid.
+func parseDistance(w http.ResponseWriter, value string) (int, bool) {
+	distance, err := strconv.Atoi(value)
+	if err != nil || distance < 0 {
+		parameterError(w, "distance", "numeric")
+		return 0, false
+	}
+	if maxDistance := fuzzyStore.limits.MaxDistance; maxDistance > 0 && distance > maxDistance {
+		parameterError(w, "distance", fmt.Sprintf("at most %d", maxDistance))
+		return 0, false
+	}
+	return distance, true
+}
+
+// optionalResults parses the results parameter, which defaults to the
+// configured number of results and may not be larger than the configured
+// maximum. It answers with an error and returns false if it is not valid.
+func optionalResults(w http.ResponseWriter, r *http.Request) (int, bool) {
+	value := r.FormValue("results")
+	if len(value) == 0 {
+		return fuzzyStore.limits.DefaultResults, true
+	}
+	results, err := strconv.Atoi(value)
+	if err != nil || results < 1 {
+		parameterError(w, "results", "numeric")
+		return 0, false
+	}
+	if results > fuzzyStore.limits.MaxResults {
+		parameterError(w, "results", fmt.Sprintf("at most %d", fuzzyStore.limits.MaxResults))
+		return 0, false
+	}
+	return results, true
+}
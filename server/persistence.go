@@ -0,0 +1,205 @@
+package server
+
+import (
+	"../fuzzy"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const snapshotExtension = ".snapshot"
+
+// errNoDataDirectory is returned when persistence is requested but the
+// server was not given a data directory to keep snapshots in
+var errNoDataDirectory = errors.New("no data directory has been configured")
+
+// errClosed is returned by the mutations made after Close, which the final
+// snapshots would not hold
+var errClosed = errors.New("the server has been closed")
+
+// closed tells whether Close has been called
+func closed() bool {
+	fuzzyStore.JournalsLock.RLock()
+	defer fuzzyStore.JournalsLock.RUnlock()
+	return fuzzyStore.closed
+}
+
+func snapshotPath(name string) string {
+	return filepath.Join(fuzzyStore.dataDir, url.PathEscape(name)+snapshotExtension)
+}
+
+// Restore makes dir the data directory of the server and loads every store
+// snapshot found in it. The directory is created if it does not exist yet.
+//
+// Arguments:
+// dir (string): the directory holding the snapshots
+//
+// Returns: (error) the first error encountered while loading the snapshots
+func Restore(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	fuzzyStore.dataDir = dir
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+snapshotExtension))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		name, err := url.PathUnescape(strings.TrimSuffix(filepath.Base(path), snapshotExtension))
+		if err != nil {
+			return fmt.Errorf("invalid snapshot name %s: %v", path, err)
+		}
+		config, err := loadStoreConfig(name)
+		if err != nil {
+			return fmt.Errorf("could not load the configuration of store %s: %v", name, err)
+		}
+		options, err := config.options()
+		if err != nil {
+			return fmt.Errorf("invalid configuration of store %s: %v", name, err)
+		}
+		store, err := fuzzy.LoadSnapshot(path, options)
+		if err != nil {
+			return fmt.Errorf("could not load snapshot %s: %v", path, err)
+		}
+
+		registerStore(name, store, config)
+
+		slog.Info("Loaded a store", "store", name, "keys", store.Len(), "path", path)
+	}
+	return nil
+}
+
+// persistStore saves the snapshot of a store and then compacts its
+// write-ahead log, since every mutation it holds is part of the snapshot
+func persistStore(name string) error {
+	store, present := getStore(name)
+	if !present {
+		return fmt.Errorf("store %s does not exist", name)
+	}
+	j, present := getJournal(name)
+	if !present {
+		return store.SaveSnapshot(snapshotPath(name))
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	// The log is only truncated once the snapshot replacing it is durable
+	if err := store.SaveSnapshot(snapshotPath(name)); err != nil {
+		return err
+	}
+	return j.log.Truncate()
+}
+
+func removeSnapshot(name string) {
+	if len(fuzzyStore.dataDir) == 0 {
+		return
+	}
+	if err := os.Remove(snapshotPath(name)); err != nil && !os.IsNotExist(err) {
+		slog.Warn("Could not remove the snapshot of a store", "store", name, "error", err)
+	}
+}
+
+// Persist writes a snapshot of every store to the data directory given
+// to Restore.
+//
+// Returns: (error) the first error encountered while writing the snapshots
+func Persist() error {
+	if len(fuzzyStore.dataDir) == 0 {
+		return errNoDataDirectory
+	}
+
+	fuzzyStore.StoresLock.RLock()
+	names := make([]string, 0, len(fuzzyStore.stores))
+	for name := range fuzzyStore.stores {
+		names = append(names, name)
+	}
+	fuzzyStore.StoresLock.RUnlock()
+
+	for _, name := range names {
+		if err := persistStore(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close saves a snapshot of every store and then closes their write-ahead
+// logs. It is meant to be called once the server has stopped handling
+// requests, right before exiting. The logs are closed even if a snapshot
+// could not be saved, since they still hold the mutations it would lose.
+// Requests still running, for example because they outlived the shutdown
+// timeout, can not mutate the stores any more: they get an error instead.
+//
+// Returns: (error) the first error encountered while saving or closing
+func Close() error {
+	fuzzyStore.JournalsLock.Lock()
+	fuzzyStore.closed = true
+	fuzzyStore.JournalsLock.Unlock()
+
+	err := Persist()
+
+	fuzzyStore.JournalsLock.Lock()
+	journals := fuzzyStore.journals
+	fuzzyStore.journals = make(map[string]*journal)
+	fuzzyStore.JournalsLock.Unlock()
+
+	for name, j := range journals {
+		j.mutex.Lock()
+		if closeErr := j.log.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("could not close the journal of store %s: %v", name, closeErr)
+		}
+		j.mutex.Unlock()
+	}
+	return err
+}
+
+func snapshotHandler(w http.ResponseWriter, r *http.Request) {
+	/* An optional store parameter narrows the snapshot to a single store */
+	name := r.FormValue("store")
+	if len(name) == 0 {
+		name = allStores
+	}
+	if !authorize(w, r, name, adminPermission) {
+		return
+	}
+	if len(fuzzyStore.dataDir) == 0 {
+		writeError(w, http.StatusServiceUnavailable, apiError{codeUnavailable, "", errNoDataDirectory.Error()})
+		return
+	}
+	if name != allStores {
+		if _, present := getStore(name); !present {
+			storeNotFoundError(w)
+			return
+		}
+		if err := persistStore(name); err != nil {
+			internalError(w, err.Error())
+			return
+		}
+		fmt.Fprint(w, "Successfully saved the store")
+		return
+	}
+
+	if err := Persist(); err != nil {
+		internalError(w, err.Error())
+		return
+	}
+	fmt.Fprint(w, "Successfully saved all the stores")
+}
+
+// SnapshotHandler lets administrators save snapshots of the stores to the
+// data directory on demand.
+func SnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "POST":
+		snapshotHandler(w, r)
+		return
+	default:
+		methodNotAllowedError(w)
+	}
+}
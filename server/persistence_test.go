@@ -0,0 +1,62 @@
+package server
+
+import (
+	"../fuzzy"
+	"../wal"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestClose(t *testing.T) {
+	if err := Restore(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := EnableJournals(wal.SyncPolicy{Mode: wal.SyncAlways}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		fuzzyStore.closed = false
+		fuzzyStore.dataDir = ""
+		fuzzyStore.journalPolicy = nil
+		for _, name := range []string{"closed", "late"} {
+			dropStore(name)
+		}
+	})
+	if err := createStore("closed", storeConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	store, _ := getStore("closed")
+	if err := setKey("closed", store, "ana", "super"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	/* Requests outliving the shutdown can not change what was saved */
+	if err := setKey("closed", store, "anna", "value"); err != errClosed {
+		t.Error("Mutations after Close should fail, not", err)
+	}
+	if _, present := store.Get("anna"); present {
+		t.Error("Mutations after Close should not be applied")
+	}
+	parameters := url.Values{"store": {"closed"}, "key": {"anna"}, "value": {"value"}}
+	if status := serve(t, FuzzyHandler, "PUT", "/fuzzy", parameters, nil); status != http.StatusInternalServerError {
+		t.Error("Setting a key after Close answered", status)
+	}
+	if err := createStore("late", storeConfig{}); err != errClosed {
+		t.Error("Creating a store after Close should fail, not", err)
+	}
+	if err := dropStore("closed"); err != errClosed {
+		t.Error("Dropping a store after Close should fail, not", err)
+	}
+
+	restored, err := fuzzy.LoadSnapshot(snapshotPath("closed"), fuzzy.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := restored.Get("ana"); value != "super" || restored.Len() != 1 {
+		t.Error("The final snapshot should hold the mutations made before Close only")
+	}
+}
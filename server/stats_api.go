@@ -0,0 +1,89 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type storeReport struct {
+	Queries map[string]int `json:"queries"`
+	Keys    int            `json:"keys"`
+	Created time.Time      `json:"created"`
+}
+
+func storeReportFor(name string) (storeReport, bool) {
+	store, present := getStore(name)
+	if !present {
+		return storeReport{}, false
+	}
+
+	fuzzyStore.StatsLock.RLock()
+	stats, present := fuzzyStore.stats[name]
+	if !present {
+		fuzzyStore.StatsLock.RUnlock()
+		return storeReport{}, false
+	}
+	queries := make(map[string]int, len(stats.Queries))
+	for operation, count := range stats.Queries {
+		queries[operation] = count
+	}
+	fuzzyStore.StatsLock.RUnlock()
+
+	return storeReport{queries, store.Len(), stats.Created}, true
+}
+
+func getStatsHandler(w http.ResponseWriter, r *http.Request) {
+	result := make(map[string]storeReport)
+
+	/* An optional store parameter narrows the report to a single store */
+	name := r.FormValue("store")
+	if len(name) != 0 {
+		if !authorize(w, r, name, readPermission) {
+			return
+		}
+		report, present := storeReportFor(name)
+		if !present {
+			storeNotFoundError(w)
+			return
+		}
+		result[name] = report
+	} else {
+		/* Only the stores the API key may read are reported */
+		key, valid := authenticated(w, r)
+		if !valid {
+			return
+		}
+		fuzzyStore.StoresLock.RLock()
+		names := make([]string, 0, len(fuzzyStore.stores))
+		for name := range fuzzyStore.stores {
+			if key.allows(name, readPermission) {
+				names = append(names, name)
+			}
+		}
+		fuzzyStore.StoresLock.RUnlock()
+
+		for _, name := range names {
+			if report, present := storeReportFor(name); present {
+				result[name] = report
+			}
+		}
+	}
+
+	jsonResponse, _ := json.Marshal(result)
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, string(jsonResponse))
+}
+
+// StatsHandler reports the operation counters, the number of keys and the
+// creation time of every store, or of a single one if requested.
+func StatsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		getStatsHandler(w, r)
+		return
+	default:
+		methodNotAllowedError(w)
+	}
+}
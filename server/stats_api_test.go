@@ -0,0 +1,34 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	if err := createStore("stats", storeConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dropStore("stats") })
+	serve(t, FuzzyHandler, "PUT", "/fuzzy", url.Values{"store": {"stats"}, "key": {"ana"}, "value": {"1"}}, nil)
+	for i := 0; i < 2; i++ {
+		serve(t, FuzzyHandler, "GET", "/fuzzy", url.Values{"store": {"stats"}, "key": {"ana"}, "distance": {"0"}}, nil)
+	}
+
+	var report map[string]storeReport
+	if status := serve(t, StatsHandler, "GET", "/fuzzy/stats", url.Values{"store": {"stats"}}, &report); status != http.StatusOK ||
+		len(report) != 1 || report["stats"].Keys != 1 || report["stats"].Queries["/fuzzy GET"] != 2 {
+		t.Errorf("Stats of a store answered %d %+v", status, report)
+	}
+	if serve(t, StatsHandler, "GET", "/fuzzy/stats", nil, &report); len(report) == 0 {
+		t.Error("Stats of every store should report the store")
+	}
+
+	/* Requests may still count an operation on a store dropped meanwhile */
+	dropStore("stats")
+	incrementStats("stats", "/fuzzy GET")
+	if _, present := storeReportFor("stats"); present {
+		t.Error("Counting an operation should not bring a dropped store back")
+	}
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"../fuzzy"
+	"../phonetic"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const configExtension = ".json"
+
+// storeConfig holds the settings a store was created with. It is saved next
+// to the snapshot of the store, since snapshots only hold the content.
+type storeConfig struct {
+	Normalize []string  `json:"normalize,omitempty"`
+	Multimap  bool      `json:"multimap,omitempty"`
+	Phonetic  string    `json:"phonetic,omitempty"`
+	Created   time.Time `json:"created"`
+}
+
+func configPath(name string) string {
+	return filepath.Join(fuzzyStore.dataDir, url.PathEscape(name)+configExtension)
+}
+
+// options builds the fuzzy.Options of a store with this configuration
+func (config storeConfig) options() (fuzzy.Options, error) {
+	options := fuzzy.Options{Multimap: config.Multimap}
+	if len(config.Normalize) != 0 {
+		normalizer, err := fuzzy.NamedNormalizer(config.Normalize)
+		if err != nil {
+			return options, err
+		}
+		options.Normalizer = normalizer
+	}
+	if len(config.Phonetic) != 0 {
+		encoder, present := phonetic.Named(config.Phonetic)
+		if !present {
+			return options, fmt.Errorf("unknown phonetic encoder %q", config.Phonetic)
+		}
+		options.Phonetic = encoder
+	}
+	return options, nil
+}
+
+// parseNormalize reads the comma separated list of normalizer names given
+// when creating a store
+func parseNormalize(value string) ([]string, bool) {
+	if len(value) == 0 {
+		return nil, true
+	}
+	names := strings.Split(value, ",")
+	for i := range names {
+		names[i] = strings.TrimSpace(names[i])
+	}
+	_, err := fuzzy.NamedNormalizer(names)
+	return names, err == nil
+}
+
+func getStoreConfig(name string) (storeConfig, bool) {
+	fuzzyStore.StoresLock.RLock()
+	config, present := fuzzyStore.configs[name]
+	fuzzyStore.StoresLock.RUnlock()
+	return config, present
+}
+
+// loadStoreConfig reads the configuration saved for a store. Stores saved
+// before configurations were kept get the default one.
+func loadStoreConfig(name string) (storeConfig, error) {
+	config := storeConfig{Created: time.Now()}
+	data, err := os.ReadFile(configPath(name))
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return config, err
+	}
+	err = json.Unmarshal(data, &config)
+	return config, err
+}
+
+// saveStoreConfig writes the configuration of a store to the data directory,
+// if there is one
+func saveStoreConfig(name string, config storeConfig) error {
+	if len(fuzzyStore.dataDir) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(configPath(name), data, 0644)
+}
+
+func removeStoreConfig(name string) {
+	if len(fuzzyStore.dataDir) == 0 {
+		return
+	}
+	if err := os.Remove(configPath(name)); err != nil && !os.IsNotExist(err) {
+		slog.Warn("Could not remove the configuration of a store", "store", name, "error", err)
+	}
+}
+
+// newConfiguredStore creates an empty store with the given configuration
+func newConfiguredStore(config storeConfig) (*fuzzy.Service, error) {
+	options, err := config.options()
+	if err != nil {
+		return nil, err
+	}
+	return fuzzy.NewServiceWithOptions(options), nil
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"../fuzzy"
+	"../phonetic"
+	"../wal"
+	"errors"
+	"net/http"
+	"time"
+)
+
+/* The operations on stores and keys shared by the legacy /fuzzy API and the
+   versioned one. They keep the journals, snapshots and configurations of the
+   stores in sync with their content. */
+
+// storeConfigFrom reads the settings of a new store from the request. It
+// answers with an error and returns false if they are not valid.
+func storeConfigFrom(w http.ResponseWriter, r *http.Request) (storeConfig, bool) {
+	/* Keys and queries of the store may be normalized, for example to ignore
+	   case and accents, by giving a comma separated list of normalizers */
+	normalize, valid := parseNormalize(r.FormValue("normalize"))
+	if !valid {
+		parameterError(w, "normalize", "lowercase, accents, whitespace or punctuation")
+		return storeConfig{}, false
+	}
+	/* In multimap stores every key may index several values */
+	multimap, valid := optionalBool("multimap", r)
+	if !valid {
+		parameterError(w, "multimap", "boolean")
+		return storeConfig{}, false
+	}
+	/* Phonetic stores also index how their keys sound, so that queries
+	   find the keys pronounced like them whatever their spelling */
+	encoder := r.FormValue("phonetic")
+	if _, known := phonetic.Named(encoder); len(encoder) != 0 && !known {
+		parameterError(w, "phonetic", "soundex, metaphone or french")
+		return storeConfig{}, false
+	}
+	return storeConfig{Normalize: normalize, Multimap: multimap, Phonetic: encoder, Created: time.Now()}, true
+}
+
+// errDuplicateStore is returned when creating a store which already exists
+var errDuplicateStore = errors.New("store already exists")
+
+// createStore creates and registers an empty store, unless it already
+// exists. Both happen under the StoresLock, so that concurrent requests can
+// not create the same store twice.
+func createStore(name string, config storeConfig) error {
+	store, err := newConfiguredStore(config)
+	if err != nil {
+		return err
+	}
+
+	fuzzyStore.StoresLock.Lock()
+	defer fuzzyStore.StoresLock.Unlock()
+	if _, present := fuzzyStore.stores[name]; present {
+		return errDuplicateStore
+	}
+	if closed() {
+		return errClosed
+	}
+	if err = saveStoreConfig(name, config); err != nil {
+		return err
+	}
+
+	/* With journaling enabled every store gets a write-ahead log before
+	   it accepts any mutation */
+	if fuzzyStore.journalPolicy != nil {
+		if err = openJournal(name, store); err != nil {
+			return err
+		}
+	}
+	addStore(name, store, config)
+	return nil
+}
+
+// dropStore deletes a store along with everything persisted for it, unless
+// the server has been closed
+func dropStore(name string) error {
+	if closed() {
+		return errClosed
+	}
+	fuzzyStore.StoresLock.Lock()
+	delete(fuzzyStore.stores, name)
+	delete(fuzzyStore.configs, name)
+	fuzzyStore.StoresLock.Unlock()
+
+	fuzzyStore.StatsLock.Lock()
+	delete(fuzzyStore.stats, name)
+	fuzzyStore.StatsLock.Unlock()
+
+	closeJournal(name)
+	removeSnapshot(name)
+	removeStoreConfig(name)
+	return nil
+}
+
+// setKey journals and applies the setting of a key
+func setKey(name string, store *fuzzy.Service, key, value string) error {
+	record := wal.Record{Operation: wal.Set, Key: key, Value: value}
+	return journaled(name, func() {
+		fuzzyStore.StoresLock.Lock()
+		store.Set(key, value)
+		fuzzyStore.StoresLock.Unlock()
+	}, record)
+}
+
+// deleteKey journals and applies the deletion of a key, or of a single
+// key/value pair when value is not empty. It reports whether anything
+// was deleted.
+func deleteKey(name string, store *fuzzy.Service, key, value string) (bool, error) {
+	var deleted bool
+	record := wal.Record{Operation: wal.Delete, Key: key}
+	if len(value) != 0 {
+		record = wal.Record{Operation: wal.DeleteValue, Key: key, Value: value}
+	}
+	err := journaled(name, func() {
+		if record.Operation == wal.DeleteValue {
+			deleted = store.DeleteValue(key, value)
+		} else {
+			deleted = store.Delete(key)
+		}
+	}, record)
+	return deleted, err
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestCreateStoreOnce(t *testing.T) {
+	t.Cleanup(func() { dropStore("once") })
+	var created sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		created.Add(1)
+		go func() {
+			defer created.Done()
+			errs <- createStore("once", storeConfig{})
+		}()
+	}
+	created.Wait()
+	close(errs)
+
+	successes := 0
+	for err := range errs {
+		switch err {
+		case nil:
+			successes++
+		case errDuplicateStore:
+		default:
+			t.Error(err)
+		}
+	}
+	if successes != 1 {
+		t.Errorf("Concurrent creations of a store should create it once, not %d times", successes)
+	}
+}
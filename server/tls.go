@@ -0,0 +1,142 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// certificateCheckInterval is how often the certificate files are checked
+// for changes, at most
+const certificateCheckInterval = 10 * time.Second
+
+// errNoCertificates is returned when a file of certificate authorities does
+// not hold any certificate
+var errNoCertificates = errors.New("no PEM encoded certificate found")
+
+// CertificateReloader serves a certificate and its private key from files,
+// loading them again whenever the files change, so that rotated certificates
+// are used without restarting the server.
+type CertificateReloader struct {
+	certFile    string
+	keyFile     string
+	interval    time.Duration
+	mutex       sync.Mutex
+	certificate *tls.Certificate
+	modified    [2]time.Time
+	checked     time.Time
+}
+
+// NewCertificateReloader loads a certificate and its private key, which are
+// loaded again once the files change.
+//
+// Arguments:
+// certFile (string): the PEM encoded certificate, followed by its chain
+// keyFile (string): the PEM encoded private key
+//
+// Returns: (*CertificateReloader, error) the reloader, or an error if the
+// certificate could not be loaded
+func NewCertificateReloader(certFile, keyFile string) (*CertificateReloader, error) {
+	reloader := &CertificateReloader{certFile: certFile, keyFile: keyFile, interval: certificateCheckInterval}
+	modified, err := reloader.lastModified()
+	if err != nil {
+		return nil, err
+	}
+	if err = reloader.load(modified); err != nil {
+		return nil, err
+	}
+	reloader.checked = time.Now()
+	return reloader, nil
+}
+
+func (reloader *CertificateReloader) lastModified() ([2]time.Time, error) {
+	var modified [2]time.Time
+	for i, path := range []string{reloader.certFile, reloader.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return modified, err
+		}
+		modified[i] = info.ModTime()
+	}
+	return modified, nil
+}
+
+func (reloader *CertificateReloader) load(modified [2]time.Time) error {
+	certificate, err := tls.LoadX509KeyPair(reloader.certFile, reloader.keyFile)
+	if err != nil {
+		return err
+	}
+	reloader.certificate = &certificate
+	reloader.modified = modified
+	return nil
+}
+
+// GetCertificate returns the current certificate, after loading it again if
+// its files changed. A certificate which can not be loaded, for example
+// because only one of the files has been replaced yet, is ignored until the
+// next change and the previous one keeps being served. It is meant to be
+// used as the GetCertificate function of a tls.Config.
+func (reloader *CertificateReloader) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	reloader.mutex.Lock()
+	defer reloader.mutex.Unlock()
+	if time.Since(reloader.checked) < reloader.interval {
+		return reloader.certificate, nil
+	}
+	reloader.checked = time.Now()
+
+	modified, err := reloader.lastModified()
+	if err != nil || modified == reloader.modified {
+		return reloader.certificate, nil
+	}
+	if err = reloader.load(modified); err != nil {
+		slog.Warn("Could not reload the TLS certificate", "cert", reloader.certFile, "error", err)
+		return reloader.certificate, nil
+	}
+	slog.Info("Reloaded the TLS certificate", "cert", reloader.certFile)
+	return reloader.certificate, nil
+}
+
+// NewTLSConfig creates the TLS configuration of the server, which serves
+// HTTP/2 as well as HTTP/1.1 and reloads its certificate when it is rotated.
+// If a file of certificate authorities is given, clients must present a
+// certificate signed by one of them.
+//
+// Arguments:
+// certFile (string): the PEM encoded certificate of the server
+// keyFile (string): the PEM encoded private key of the server
+// clientCAFile (string): the PEM encoded authorities of the client
+// certificates, or an empty string to not ask clients for certificates
+//
+// Returns: (*tls.Config, error) the configuration or the error encountered
+// while loading the files
+func NewTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	reloader, err := NewCertificateReloader(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+	if len(clientCAFile) == 0 {
+		return config, nil
+	}
+
+	data, err := os.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	authorities := x509.NewCertPool()
+	if !authorities.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%s: %w", clientCAFile, errNoCertificates)
+	}
+	config.ClientCAs = authorities
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+	return config, nil
+}
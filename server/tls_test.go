@@ -0,0 +1,240 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCertificate struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+	certPEM     []byte
+	keyPEM      []byte
+}
+
+// newTestCertificate creates a certificate signed by parent, or a self-signed
+// authority if parent is nil
+func newTestCertificate(t *testing.T, serial int64, parent *testCertificate) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "fuzzyguy test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.certificate, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, _ := x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	return &testCertificate{
+		certificate: certificate,
+		key:         key,
+		certPEM:     pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:      pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func (c *testCertificate) write(t *testing.T, certFile, keyFile string) {
+	if err := os.WriteFile(certFile, c.certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, c.keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// startTLSServer serves with the given configuration the way the server
+// does, and returns its URL
+func startTLSServer(t *testing.T, config *tls.Config) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{
+		Handler:   http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		TLSConfig: config,
+		ErrorLog:  log.New(io.Discard, "", 0),
+	}
+	go server.ServeTLS(listener, "", "")
+	t.Cleanup(func() { server.Close() })
+	return "https://" + listener.Addr().String()
+}
+
+func clientFor(authority *testCertificate, certificates ...tls.Certificate) *http.Client {
+	roots := x509.NewCertPool()
+	roots.AddCert(authority.certificate)
+	return &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: roots, Certificates: certificates},
+		ForceAttemptHTTP2: true,
+	}}
+}
+
+func TestTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	authority := newTestCertificate(t, 1, nil)
+	newTestCertificate(t, 2, authority).write(t, certFile, keyFile)
+
+	config, err := NewTLSConfig(certFile, keyFile, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := clientFor(authority).Get(startTLSServer(t, config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.ProtoMajor != 2 {
+		t.Error("Server should speak HTTP/2, not", response.Proto)
+	}
+	if serial := response.TLS.PeerCertificates[0].SerialNumber.Int64(); serial != 2 {
+		t.Error("Server presented certificate", serial)
+	}
+
+	if _, err = NewTLSConfig(filepath.Join(dir, "missing.pem"), keyFile, ""); err == nil {
+		t.Error("Missing certificate was accepted")
+	}
+}
+
+func TestTLSReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	authority := newTestCertificate(t, 1, nil)
+	newTestCertificate(t, 2, authority).write(t, certFile, keyFile)
+
+	reloader, err := NewCertificateReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloader.interval = 0
+	url := startTLSServer(t, &tls.Config{GetCertificate: reloader.GetCertificate})
+	client := clientFor(authority)
+	served := func() int64 {
+		client.CloseIdleConnections()
+		response, err := client.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		return response.TLS.PeerCertificates[0].SerialNumber.Int64()
+	}
+
+	if serial := served(); serial != 2 {
+		t.Error("Server presented certificate", serial)
+	}
+	newTestCertificate(t, 3, authority).write(t, certFile, keyFile)
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+	if serial := served(); serial != 3 {
+		t.Error("Server presented certificate", serial, "after the rotation")
+	}
+}
+
+func TestCertificateReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	authority := newTestCertificate(t, 1, nil)
+	newTestCertificate(t, 2, authority).write(t, certFile, keyFile)
+
+	reloader, err := NewCertificateReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloader.interval = 0
+	serial := func() int64 {
+		certificate, _ := reloader.GetCertificate(nil)
+		parsed, _ := x509.ParseCertificate(certificate.Certificate[0])
+		return parsed.SerialNumber.Int64()
+	}
+
+	/* A half rotated pair keeps the previous certificate */
+	rotated := newTestCertificate(t, 3, authority)
+	os.WriteFile(certFile, rotated.certPEM, 0600)
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+	if serial() != 2 {
+		t.Error("Reloader should keep the previous certificate until the key is replaced")
+	}
+
+	os.WriteFile(keyFile, rotated.keyPEM, 0600)
+	os.Chtimes(keyFile, future, future)
+	if serial() != 3 {
+		t.Error("Reloader did not load the rotated certificate")
+	}
+
+	/* Changes are only looked for once per interval */
+	reloader.interval = time.Hour
+	reloader.checked = time.Now()
+	newTestCertificate(t, 4, authority).write(t, certFile, keyFile)
+	later := future.Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	if serial() != 3 {
+		t.Error("Reloader checked the files before the interval elapsed")
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), filepath.Join(dir, "ca.pem")
+	authority := newTestCertificate(t, 1, nil)
+	newTestCertificate(t, 2, authority).write(t, certFile, keyFile)
+	os.WriteFile(caFile, authority.certPEM, 0600)
+
+	config, err := NewTLSConfig(certFile, keyFile, caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := startTLSServer(t, config)
+
+	if _, err = clientFor(authority).Get(url); err == nil {
+		t.Error("Client without a certificate was accepted")
+	}
+
+	stranger := newTestCertificate(t, 5, newTestCertificate(t, 4, nil))
+	strangerPair, _ := tls.X509KeyPair(stranger.certPEM, stranger.keyPEM)
+	if _, err = clientFor(authority, strangerPair).Get(url); err == nil {
+		t.Error("Client with a certificate from another authority was accepted")
+	}
+
+	client := newTestCertificate(t, 6, authority)
+	clientPair, _ := tls.X509KeyPair(client.certPEM, client.keyPEM)
+	response, err := clientFor(authority, clientPair).Get(url)
+	if err != nil {
+		t.Fatal("Client with a valid certificate was refused:", err)
+	}
+	response.Body.Close()
+
+	os.WriteFile(caFile, []byte("not a certificate"), 0600)
+	if _, err = NewTLSConfig(certFile, keyFile, caFile); err == nil {
+		t.Error("Invalid authorities file was accepted")
+	}
+}
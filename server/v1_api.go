@@ -0,0 +1,343 @@
+package server
+
+import (
+	"../fuzzy"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/* The versioned API addresses stores and keys through resource paths:
+
+   /v1/stores                        GET lists and describes every store
+   /v1/stores/{store}                GET describes, PUT creates and DELETE deletes a store
+   /v1/stores/{store}/keys           GET scans the keys one page at a time
+   /v1/stores/{store}/keys/{key}     GET gets, PUT sets and DELETE deletes a key
+   /v1/stores/{store}/search         GET queries the keys close to the query parameter
+
+   Path segments are URL escaped, so keys holding a slash are given as %2F.
+   The remaining parameters are sent as form values or as an application/json
+   body, like for the legacy /fuzzy API. */
+
+const v1Prefix = "/v1/"
+
+// storeDescription is what the versioned API tells about a store: its number
+// of keys, an estimate of its size in bytes, the settings it was created
+// with, its creation time and how its keys are spread over the index
+type storeDescription struct {
+	Name   string `json:"name"`
+	Keys   int    `json:"keys"`
+	Size   int    `json:"size"`
+	Config struct {
+		Normalize []string `json:"normalize"`
+		Multimap  bool     `json:"multimap"`
+		Phonetic  string   `json:"phonetic"`
+	} `json:"config"`
+	Created time.Time   `json:"created"`
+	Index   fuzzy.Stats `json:"index"`
+}
+
+func describeStore(name string) (storeDescription, bool) {
+	store, present := getStore(name)
+	if !present {
+		return storeDescription{}, false
+	}
+	config, _ := getStoreConfig(name)
+
+	description := storeDescription{Name: name, Keys: store.Len(), Size: store.Size(), Created: config.Created, Index: store.Stats()}
+	description.Config.Normalize = config.Normalize
+	if description.Config.Normalize == nil {
+		description.Config.Normalize = []string{}
+	}
+	description.Config.Multimap = config.Multimap
+	description.Config.Phonetic = config.Phonetic
+	return description, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	jsonResponse, _ := json.Marshal(value)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprint(w, string(jsonResponse))
+}
+
+func notFoundError(w http.ResponseWriter) {
+	writeError(w, http.StatusNotFound, apiError{codeNotFound, "", "There is no such resource"})
+}
+
+// pathSegments splits the escaped path following the /v1/ prefix into its
+// unescaped segments
+func pathSegments(path string) ([]string, bool) {
+	path = strings.TrimSuffix(strings.TrimPrefix(path, v1Prefix), "/")
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil || len(unescaped) == 0 {
+			return nil, false
+		}
+		segments[i] = unescaped
+	}
+	return segments, true
+}
+
+func listStoresHandler(w http.ResponseWriter, r *http.Request) {
+	/* Only the stores the API key may read are listed */
+	key, valid := authenticated(w, r)
+	if !valid {
+		return
+	}
+	fuzzyStore.StoresLock.RLock()
+	names := make([]string, 0, len(fuzzyStore.stores))
+	for name := range fuzzyStore.stores {
+		if key.allows(name, readPermission) {
+			names = append(names, name)
+		}
+	}
+	fuzzyStore.StoresLock.RUnlock()
+	sort.Strings(names)
+
+	result := make([]storeDescription, 0, len(names))
+	for _, name := range names {
+		if description, present := describeStore(name); present {
+			result = append(result, description)
+		}
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func v1StoreHandler(w http.ResponseWriter, r *http.Request, name string) {
+	switch r.Method {
+	case "GET":
+		if !authorize(w, r, name, readPermission) {
+			return
+		}
+		description, present := describeStore(name)
+		if !present {
+			writeError(w, http.StatusNotFound, errStoreNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, description)
+	case "PUT":
+		if !authorize(w, r, name, adminPermission) {
+			return
+		}
+		config, valid := storeConfigFrom(w, r)
+		if !valid {
+			return
+		}
+		err := createStore(name, config)
+		if err == errDuplicateStore {
+			writeError(w, http.StatusConflict, errStoreExists)
+			return
+		}
+		if err != nil {
+			internalError(w, err.Error())
+			return
+		}
+		incrementStats(name, "/v1/stores PUT")
+		description, _ := describeStore(name)
+		writeJSON(w, http.StatusCreated, description)
+	case "DELETE":
+		if !authorize(w, r, name, adminPermission) {
+			return
+		}
+		if _, present := getStore(name); !present {
+			writeError(w, http.StatusNotFound, errStoreNotFound)
+			return
+		}
+		if err := dropStore(name); err != nil {
+			internalError(w, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowedError(w)
+	}
+}
+
+func v1KeyHandler(w http.ResponseWriter, r *http.Request, name, key string) {
+	required := writePermission
+	if r.Method == "GET" {
+		required = readPermission
+	}
+	if !authorize(w, r, name, required) {
+		return
+	}
+	store, present := getStore(name)
+	if !present {
+		writeError(w, http.StatusNotFound, errStoreNotFound)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		values, present := store.GetAll(key)
+		if !present {
+			writeError(w, http.StatusNotFound, errKeyNotFound)
+			return
+		}
+		incrementStats(name, "/v1/keys GET")
+		writeJSON(w, http.StatusOK, exactMatch(store, key, values))
+	case "PUT":
+		parameters, valid := requireParameters([]string{"value"}, w, r)
+		if !valid {
+			return
+		}
+		if err := setKey(name, store, key, parameters["value"]); err != nil {
+			internalError(w, "Could not record the change")
+			return
+		}
+		incrementStats(name, "/v1/keys PUT")
+		w.WriteHeader(http.StatusNoContent)
+	case "DELETE":
+		/* An optional value parameter deletes a single key/value pair */
+		deleted, err := deleteKey(name, store, key, r.FormValue("value"))
+		if err != nil {
+			internalError(w, "Could not record the change")
+			return
+		}
+		if !deleted {
+			writeError(w, http.StatusNotFound, errKeyNotFound)
+			return
+		}
+		incrementStats(name, "/v1/keys DELETE")
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowedError(w)
+	}
+}
+
+// scanPage is one page of a scan, along with the cursor of the next page,
+// which is empty after the last one
+type scanPage struct {
+	Keys []fuzzy.Entry `json:"keys"`
+	Next string        `json:"next"`
+}
+
+const (
+	defaultScanLimit = 100
+	maxScanLimit     = 1000
+)
+
+func v1ScanHandler(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != "GET" {
+		methodNotAllowedError(w)
+		return
+	}
+	if !authorize(w, r, name, readPermission) {
+		return
+	}
+	store, present := getStore(name)
+	if !present {
+		writeError(w, http.StatusNotFound, errStoreNotFound)
+		return
+	}
+
+	limit := defaultScanLimit
+	if value := r.FormValue("limit"); len(value) != 0 {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > maxScanLimit {
+			parameterError(w, "limit", fmt.Sprintf("between 1 and %d", maxScanLimit))
+			return
+		}
+	}
+	/* Cursors are opaque to clients, they hold the cursor the store gave
+	   with the previous page */
+	cursor, err := base64.RawURLEncoding.DecodeString(r.FormValue("cursor"))
+	if err != nil {
+		parameterError(w, "cursor", "")
+		return
+	}
+
+	keys, next := store.Scan(string(cursor), limit)
+	incrementStats(name, "/v1/keys SCAN")
+	writeJSON(w, http.StatusOK, scanPage{keys, base64.RawURLEncoding.EncodeToString([]byte(next))})
+}
+
+func v1SearchHandler(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != "GET" {
+		methodNotAllowedError(w)
+		return
+	}
+	if !authorize(w, r, name, readPermission) {
+		return
+	}
+	store, present := getStore(name)
+	if !present {
+		writeError(w, http.StatusNotFound, errStoreNotFound)
+		return
+	}
+
+	metric, valid := optionalMetric(r)
+	if !valid {
+		parameterError(w, "metric", "levenshtein, damerau or jarowinkler")
+		return
+	}
+	tokens, valid := optionalTokens(w, r, metric)
+	if !valid {
+		return
+	}
+	parameters, valid := requireParameters([]string{"query"}, w, r)
+	if !valid {
+		return
+	}
+	/* Similarity metrics take a minimum similarity rather than a distance,
+	   the tokens mode takes both */
+	distance, valid := metricDistance(w, r, metric)
+	if !valid {
+		return
+	}
+	similarity := 0.0
+	if metric == fuzzy.JaroWinkler || tokens {
+		if similarity, valid = optionalSimilarity(w, r); !valid {
+			return
+		}
+	}
+	results, valid := optionalResults(w, r)
+	if !valid {
+		return
+	}
+
+	matches := approximateQuery(store, parameters["query"], metric, distance, similarity, tokens, results)
+	incrementStats(name, "/v1/search GET")
+	writeJSON(w, http.StatusOK, matches)
+}
+
+// V1Handler serves the versioned API, which addresses stores and keys
+// through resource paths such as /v1/stores/{store}/keys/{key}.
+func V1Handler(w http.ResponseWriter, r *http.Request) {
+	if err := parseJSONBody(w, r); err != nil {
+		bodyError(w)
+		return
+	}
+
+	segments, valid := pathSegments(r.URL.EscapedPath())
+	if !valid || segments[0] != "stores" {
+		notFoundError(w)
+		return
+	}
+	switch {
+	case len(segments) == 1:
+		if r.Method != "GET" {
+			methodNotAllowedError(w)
+			return
+		}
+		listStoresHandler(w, r)
+	case len(segments) == 2:
+		v1StoreHandler(w, r, segments[1])
+	case len(segments) == 3 && segments[2] == "keys":
+		v1ScanHandler(w, r, segments[1])
+	case len(segments) == 3 && segments[2] == "search":
+		v1SearchHandler(w, r, segments[1])
+	case len(segments) == 4 && segments[2] == "keys":
+		v1KeyHandler(w, r, segments[1], segments[3])
+	default:
+		notFoundError(w)
+	}
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestV1Stores(t *testing.T) {
+	t.Cleanup(func() { dropStore("v1") })
+
+	var description storeDescription
+	parameters := url.Values{"normalize": {"lowercase"}, "multimap": {"true"}}
+	if status := serve(t, V1Handler, "PUT", "/v1/stores/v1", parameters, &description); status != http.StatusCreated ||
+		description.Name != "v1" || !description.Config.Multimap || len(description.Config.Normalize) != 1 {
+		t.Errorf("Creating a store answered %d %+v", status, description)
+	}
+	var answer struct{ Error apiError }
+	if status := serve(t, V1Handler, "PUT", "/v1/stores/v1", nil, &answer); status != http.StatusConflict || answer.Error.Code != codeStoreExists {
+		t.Errorf("Creating an existing store answered %d %+v", status, answer)
+	}
+
+	for _, key := range []string{"Ana", "ana/super"} {
+		path := "/v1/stores/v1/keys/" + url.PathEscape(key)
+		if status := serve(t, V1Handler, "PUT", path, url.Values{"value": {"1"}}, nil); status != http.StatusNoContent {
+			t.Errorf("Setting %q answered %d", key, status)
+		}
+	}
+	serve(t, V1Handler, "PUT", "/v1/stores/v1/keys/ana", url.Values{"value": {"2"}}, nil)
+	var match struct {
+		Key    string
+		Values []string
+	}
+	if status := serve(t, V1Handler, "GET", "/v1/stores/v1/keys/ANA", nil, &match); status != http.StatusOK || len(match.Values) != 2 {
+		t.Errorf("Getting a key answered %d %+v", status, match)
+	}
+
+	var stores []storeDescription
+	if status := serve(t, V1Handler, "GET", "/v1/stores", nil, &stores); status != http.StatusOK || len(stores) == 0 {
+		t.Errorf("Listing the stores answered %d %+v", status, stores)
+	}
+	var page scanPage
+	if status := serve(t, V1Handler, "GET", "/v1/stores/v1/keys", url.Values{"limit": {"1"}}, &page); status != http.StatusOK ||
+		len(page.Keys) != 1 || len(page.Next) == 0 {
+		t.Errorf("Scanning the keys answered %d %+v", status, page)
+	}
+	serve(t, V1Handler, "GET", "/v1/stores/v1/keys", url.Values{"cursor": {page.Next}}, &page)
+	if len(page.Keys) != 1 || page.Keys[0].Key != "ana/super" || len(page.Next) != 0 {
+		t.Errorf("Scanning the last page answered %+v", page)
+	}
+	var matches []struct{ Key string }
+	if status := serve(t, V1Handler, "GET", "/v1/stores/v1/search", url.Values{"query": {"ama"}, "distance": {"1"}}, &matches); status != http.StatusOK || len(matches) != 1 {
+		t.Errorf("Searching the store answered %d %+v", status, matches)
+	}
+
+	if status := serve(t, V1Handler, "DELETE", "/v1/stores/v1/keys/ana", url.Values{"value": {"1"}}, nil); status != http.StatusNoContent {
+		t.Error("Deleting a value answered", status)
+	}
+	if status := serve(t, V1Handler, "DELETE", "/v1/stores/v1/keys/bob", nil, &answer); status != http.StatusNotFound || answer.Error.Code != codeKeyNotFound {
+		t.Errorf("Deleting a missing key answered %d %+v", status, answer)
+	}
+	if status := serve(t, V1Handler, "DELETE", "/v1/stores/v1", nil, nil); status != http.StatusNoContent {
+		t.Error("Deleting the store answered", status)
+	}
+	if status := serve(t, V1Handler, "GET", "/v1/stores/v1", nil, &answer); status != http.StatusNotFound || answer.Error.Code != codeStoreNotFound {
+		t.Errorf("Describing a deleted store answered %d %+v", status, answer)
+	}
+}
@@ -0,0 +1,340 @@
+// Package wal implements an append-only write-ahead log of the mutations
+// made to a fuzzy store, so they survive a crash between two snapshots.
+//
+// Exported types:
+// Log -> an open write-ahead log file
+// Record -> a single logged mutation
+// SyncPolicy -> when appended records are flushed to stable storage
+//
+// Exported functions:
+// Open -> opens or creates a log.
+// ParseSyncPolicy -> reads a SyncPolicy from its textual form.
+// Append, Replay, Truncate, Sync, Close -> methods for the Log type.
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Operations which can be recorded in the log
+const (
+	Set         byte = 1
+	Delete      byte = 2
+	DeleteValue byte = 3
+)
+
+// Record is a single mutation of a store.
+type Record struct {
+	Operation byte
+	Key       string
+	Value     string
+}
+
+// SyncMode tells when the appended records are flushed to stable storage.
+type SyncMode int
+
+const (
+	// SyncAlways flushes the log before every append is acknowledged
+	SyncAlways SyncMode = iota
+	// SyncInterval flushes the log periodically in the background
+	SyncInterval
+	// SyncNever leaves flushing to the operating system
+	SyncNever
+)
+
+// SyncPolicy holds the SyncMode of a log along with the flushing interval
+// used by SyncInterval.
+type SyncPolicy struct {
+	Mode     SyncMode
+	Interval time.Duration
+}
+
+// ParseSyncPolicy reads a sync policy from its textual form, which is either
+// "always", "never" or a duration such as "100ms" for periodic flushing.
+//
+// Arguments:
+// s (string): the textual form of the policy
+//
+// Returns: (SyncPolicy, error) the policy, or an error if s is not valid
+func ParseSyncPolicy(s string) (SyncPolicy, error) {
+	switch s {
+	case "always":
+		return SyncPolicy{Mode: SyncAlways}, nil
+	case "never":
+		return SyncPolicy{Mode: SyncNever}, nil
+	}
+	interval, err := time.ParseDuration(s)
+	if err != nil || interval <= 0 {
+		return SyncPolicy{}, fmt.Errorf("invalid sync policy %q: expected always, never or a positive duration", s)
+	}
+	return SyncPolicy{Mode: SyncInterval, Interval: interval}, nil
+}
+
+// Every record is written as a header holding the length and the CRC32
+// checksum of its payload, followed by the payload itself: the operation
+// and the varint prefixed key and value.
+const headerSize = 8
+
+// maxRecordSize bounds the payload we accept while replaying, so a corrupted
+// header can not make us allocate an arbitrary amount of memory
+const maxRecordSize = 1 << 30
+
+// ErrClosed is returned when using a log which has already been closed.
+var ErrClosed = errors.New("wal: log is closed")
+
+// Log is an append-only file of records. It is safe for concurrent use.
+//
+// A log whose failed append could not be rolled back holds the error in
+// failed, and refuses every later append: they would follow a torn record,
+// and be lost when replaying.
+type Log struct {
+	file   *os.File
+	policy SyncPolicy
+	mutex  sync.Mutex
+	dirty  bool
+	failed error
+	done   chan struct{}
+}
+
+// Open opens the log at path, creating it if it does not exist. New records
+// are appended after the existing ones.
+//
+// Arguments:
+// path (string): the log file
+// policy (SyncPolicy): when appended records are flushed to stable storage
+//
+// Returns: (*Log, error) the open log or the error encountered
+func Open(path string, policy SyncPolicy) (*Log, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = file.Seek(0, io.SeekEnd); err != nil {
+		file.Close()
+		return nil, err
+	}
+	log := &Log{file: file, policy: policy, done: make(chan struct{})}
+	if policy.Mode == SyncInterval {
+		go log.syncPeriodically()
+	}
+	return log, nil
+}
+
+func (log *Log) syncPeriodically() {
+	ticker := time.NewTicker(log.policy.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			log.Sync()
+		case <-log.done:
+			return
+		}
+	}
+}
+
+func encode(record Record) []byte {
+	payload := make([]byte, headerSize, headerSize+1+2*binary.MaxVarintLen64+len(record.Key)+len(record.Value))
+	payload = append(payload, record.Operation)
+	payload = binary.AppendUvarint(payload, uint64(len(record.Key)))
+	payload = append(payload, record.Key...)
+	payload = binary.AppendUvarint(payload, uint64(len(record.Value)))
+	payload = append(payload, record.Value...)
+	binary.LittleEndian.PutUint32(payload[0:4], uint32(len(payload)-headerSize))
+	binary.LittleEndian.PutUint32(payload[4:8], crc32.ChecksumIEEE(payload[headerSize:]))
+	return payload
+}
+
+func decode(payload []byte) (Record, bool) {
+	var record Record
+	if len(payload) == 0 {
+		return record, false
+	}
+	record.Operation, payload = payload[0], payload[1:]
+	for _, field := range []*string{&record.Key, &record.Value} {
+		length, n := binary.Uvarint(payload)
+		if n <= 0 || uint64(len(payload)-n) < length {
+			return record, false
+		}
+		*field = string(payload[n : n+int(length)])
+		payload = payload[n+int(length):]
+	}
+	return record, len(payload) == 0
+}
+
+// Append writes records at the end of the log. With SyncAlways the records
+// are on stable storage by the time Append returns. A failed write, or with
+// SyncAlways a failed sync, is cut off the log, so that records reported as
+// not appended are not replayed, nor hide the records appended after them.
+//
+// Arguments:
+// records (...Record): the records to append, in order
+//
+// Returns: (error) any error encountered while writing
+func (log *Log) Append(records ...Record) error {
+	var data []byte
+	for _, record := range records {
+		data = append(data, encode(record)...)
+	}
+
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	if log.file == nil {
+		return ErrClosed
+	}
+	if log.failed != nil {
+		return log.failed
+	}
+	offset, err := log.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err = log.file.Write(data); err != nil {
+		log.rollback(offset, err)
+		return err
+	}
+	if log.policy.Mode == SyncAlways {
+		if err = log.file.Sync(); err != nil {
+			log.rollback(offset, err)
+		}
+		return err
+	}
+	log.dirty = true
+	return nil
+}
+
+// rollback cuts off what a failed write or sync left after an offset. If it
+// can not, the log is marked as failed. The caller must hold the mutex.
+func (log *Log) rollback(offset int64, cause error) {
+	err := log.file.Truncate(offset)
+	if err == nil {
+		_, err = log.file.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		log.failed = fmt.Errorf("wal: could not roll back the failed append (%v): %w", cause, err)
+	}
+}
+
+// Replay calls apply for every record in the log, oldest first. A partially
+// written or corrupted record ends the log: it is cut off along with
+// everything after it, since it can only come from an interrupted append.
+//
+// Arguments:
+// apply (func(Record)): called for every valid record
+//
+// Returns: (int, error) the number of records replayed and any I/O error
+func (log *Log) Replay(apply func(Record)) (int, error) {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	if log.file == nil {
+		return 0, ErrClosed
+	}
+	if _, err := log.file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	reader := bufio.NewReader(log.file)
+	header := make([]byte, headerSize)
+	var offset int64
+	count := 0
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			break
+		}
+		length := binary.LittleEndian.Uint32(header[0:4])
+		if length > maxRecordSize {
+			break
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			break
+		}
+		if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(header[4:8]) {
+			break
+		}
+		record, valid := decode(payload)
+		if !valid {
+			break
+		}
+		apply(record)
+		count++
+		offset += headerSize + int64(length)
+	}
+
+	if err := log.file.Truncate(offset); err != nil {
+		return count, err
+	}
+	_, err := log.file.Seek(offset, io.SeekStart)
+	return count, err
+}
+
+// Truncate discards every record in the log. It is meant to be called once
+// the state the records lead to has been saved somewhere else. A log which
+// failed is usable again once truncated.
+//
+// Returns: (error) any error encountered while truncating
+func (log *Log) Truncate() error {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	if log.file == nil {
+		return ErrClosed
+	}
+	if err := log.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := log.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	log.dirty = false
+	if err := log.file.Sync(); err != nil {
+		return err
+	}
+	log.failed = nil
+	return nil
+}
+
+// Sync flushes the appended records to stable storage.
+//
+// Returns: (error) any error encountered while flushing
+func (log *Log) Sync() error {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	if log.file == nil {
+		return ErrClosed
+	}
+	if !log.dirty {
+		return nil
+	}
+	// A failed sync is tried again the next time
+	if err := log.file.Sync(); err != nil {
+		return err
+	}
+	log.dirty = false
+	return nil
+}
+
+// Close flushes and closes the log.
+//
+// Returns: (error) any error encountered while flushing or closing
+func (log *Log) Close() error {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	if log.file == nil {
+		return ErrClosed
+	}
+	close(log.done)
+	err := log.file.Sync()
+	if closeErr := log.file.Close(); err == nil {
+		err = closeErr
+	}
+	log.file = nil
+	return err
+}
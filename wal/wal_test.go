@@ -0,0 +1,229 @@
+package wal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func replayAll(t *testing.T, log *Log) []Record {
+	var records []Record
+	_, err := log.Replay(func(record Record) {
+		records = append(records, record)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func TestAppendReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.wal")
+	log, err := Open(path, SyncPolicy{Mode: SyncAlways})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Record{
+		{Set, "ana", "super"},
+		{Set, "café", ""},
+		{Delete, "ana", ""},
+		{Set, "", "empty key"},
+	}
+	if err = log.Append(expected[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err = log.Append(expected[1:]...); err != nil {
+		t.Fatal(err)
+	}
+	log.Close()
+
+	log, err = Open(path, SyncPolicy{Mode: SyncNever})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	records := replayAll(t, log)
+	if len(records) != len(expected) {
+		t.Fatal("Replayed", len(records), "records, should be", len(expected))
+	}
+	for i := range expected {
+		if records[i] != expected[i] {
+			t.Log(records[i], "should be", expected[i])
+			t.Error("Failed to replay the log")
+		}
+	}
+
+	/* Appending after a replay must keep the existing records */
+	log.Append(Record{Set, "another", "test"})
+	if records = replayAll(t, log); len(records) != len(expected)+1 {
+		t.Error("Append after replay lost records")
+	}
+}
+
+func TestReplayTornWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.wal")
+	log, _ := Open(path, SyncPolicy{Mode: SyncAlways})
+	log.Append(Record{Set, "ana", "super"}, Record{Set, "anan", "value"})
+	log.Close()
+
+	/* Simulate a crash in the middle of the last append */
+	info, _ := os.Stat(path)
+	os.Truncate(path, info.Size()-3)
+
+	log, _ = Open(path, SyncPolicy{Mode: SyncAlways})
+	defer log.Close()
+	records := replayAll(t, log)
+	if len(records) != 1 || records[0].Key != "ana" {
+		t.Log(records)
+		t.Fatal("Torn record should end the log")
+	}
+
+	log.Append(Record{Set, "super", "ceva"})
+	records = replayAll(t, log)
+	if len(records) != 2 || records[1].Key != "super" {
+		t.Log(records)
+		t.Error("Torn record should be cut off before new appends")
+	}
+}
+
+func TestReplayCorrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.wal")
+	log, _ := Open(path, SyncPolicy{Mode: SyncAlways})
+	log.Append(Record{Set, "ana", "super"}, Record{Set, "anan", "value"})
+	log.Close()
+
+	data, _ := os.ReadFile(path)
+	data[len(data)-1] ^= 0xff
+	os.WriteFile(path, data, 0644)
+
+	log, _ = Open(path, SyncPolicy{Mode: SyncAlways})
+	defer log.Close()
+	if records := replayAll(t, log); len(records) != 1 {
+		t.Log(records)
+		t.Error("Corrupted record should not be replayed")
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.wal")
+	log, _ := Open(path, SyncPolicy{Mode: SyncInterval, Interval: time.Millisecond})
+	defer log.Close()
+	log.Append(Record{Set, "ana", "super"})
+	if err := log.Truncate(); err != nil {
+		t.Fatal(err)
+	}
+	log.Append(Record{Set, "anan", "value"})
+	records := replayAll(t, log)
+	if len(records) != 1 || records[0].Key != "anan" {
+		t.Log(records)
+		t.Error("Truncate should discard the previous records")
+	}
+}
+
+func TestClosed(t *testing.T) {
+	log, _ := Open(filepath.Join(t.TempDir(), "store.wal"), SyncPolicy{Mode: SyncInterval, Interval: time.Millisecond})
+	log.Close()
+	if err := log.Append(Record{Set, "ana", "super"}); err != ErrClosed {
+		t.Error("Append on a closed log should fail")
+	}
+	if err := log.Close(); err != ErrClosed {
+		t.Error("Closing twice should fail")
+	}
+}
+
+func TestFailedAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.wal")
+	log, _ := Open(path, SyncPolicy{Mode: SyncAlways})
+	defer log.Close()
+	log.Append(Record{Set, "ana", "super"})
+
+	// A read only file can be neither written nor truncated
+	file := log.file
+	readOnly, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer readOnly.Close()
+	log.file = readOnly
+	if err := log.Append(Record{Set, "anan", "value"}); err == nil {
+		t.Error("Append on a read only file should fail")
+	}
+	log.file = file
+	if err := log.Append(Record{Set, "anna", "value"}); err == nil {
+		t.Error("Append should keep failing once the log could not be rolled back")
+	}
+
+	if err := log.Truncate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := log.Append(Record{Set, "anna", "value"}); err != nil {
+		t.Error("Append should succeed once the failed log is truncated:", err)
+	}
+}
+
+func TestFailedSync(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.wal")
+	log, _ := Open(path, SyncPolicy{Mode: SyncAlways})
+	defer log.Close()
+
+	// The null device takes writes, but can be neither synced nor truncated
+	file := log.file
+	null, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer null.Close()
+	log.file = null
+	if err := log.Append(Record{Set, "ana", "super"}); err == nil {
+		t.Error("Append should fail when the record can not be synced")
+	}
+	log.file = file
+	if err := log.Append(Record{Set, "anna", "value"}); err == nil {
+		t.Error("Append should keep failing once an unsynced record could not be rolled back")
+	}
+
+	/* Failed periodic syncs are tried again */
+	log.Truncate()
+	log.policy = SyncPolicy{Mode: SyncNever}
+	log.file = null
+	log.Append(Record{Set, "ana", "super"})
+	if err := log.Sync(); err == nil || !log.dirty {
+		t.Error("Failed sync should leave the log to sync")
+	}
+	log.file = file
+	if err := log.Sync(); err != nil || log.dirty {
+		t.Error("Sync should be tried again after a failure:", err)
+	}
+}
+
+func TestParseSyncPolicy(t *testing.T) {
+	var testCases = []struct {
+		text   string
+		policy SyncPolicy
+		valid  bool
+	}{
+		{"always", SyncPolicy{Mode: SyncAlways}, true},
+		{"never", SyncPolicy{Mode: SyncNever}, true},
+		{"100ms", SyncPolicy{Mode: SyncInterval, Interval: 100 * time.Millisecond}, true},
+		{"0s", SyncPolicy{}, false},
+		{"-1s", SyncPolicy{}, false},
+		{"sometimes", SyncPolicy{}, false},
+	}
+	for _, testCase := range testCases {
+		policy, err := ParseSyncPolicy(testCase.text)
+		if (err == nil) != testCase.valid || (err == nil && policy != testCase.policy) {
+			t.Log(testCase.text, "parsed as", policy, err)
+			t.Error("Failed to parse the sync policy")
+		}
+	}
+}
+
+func BenchmarkAppendNever(b *testing.B) {
+	log, _ := Open(filepath.Join(b.TempDir(), "store.wal"), SyncPolicy{Mode: SyncNever})
+	defer log.Close()
+	record := Record{Set, "informatica", "fmi unibuc"}
+	for n := 0; n < b.N; n++ {
+		log.Append(record)
+	}
+}